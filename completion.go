@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/cloverstd/tcping/ping"
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:       "completion bash|zsh|fish|powershell",
+	Short:     "生成命令行自动补全脚本",
+	Hidden:    true,
+	Args:      cobra.ExactValidArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	Example: `
+  1. 在当前 bash 中启用
+	> source <(tcping completion bash)
+  2. 为 zsh 安装
+	> tcping completion zsh > "${fpath[1]}/_tcping"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		switch args[0] {
+		case "bash":
+			return cmd.Root().GenBashCompletionV2(out, true)
+		case "zsh":
+			return cmd.Root().GenZshCompletion(out)
+		case "fish":
+			return cmd.Root().GenFishCompletion(out, true)
+		case "powershell":
+			return cmd.Root().GenPowerShellCompletionWithDesc(out)
+		}
+		return fmt.Errorf("不支持的 shell %s", args[0])
+	},
+}
+
+// completeTarget 补全目标地址的协议前缀
+func completeTarget(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var schemes []string
+	for _, spec := range ping.Protocols() {
+		for _, scheme := range spec.Schemes {
+			schemes = append(schemes, scheme+"://")
+		}
+	}
+	return schemes, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.ValidArgsFunction = completeTarget
+	rootCmd.AddCommand(completionCmd)
+}
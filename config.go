@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// loadConfig 读取配置文件中的参数作为默认值，优先级：命令行参数 > 配置文件 > 内置默认值
+func loadConfig(cmd *cobra.Command, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	values, err := parseConfig(bufio.NewScanner(f))
+	if err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败，%w", path, err)
+	}
+	// 命令行指定的参数优先，先记录下来，通过配置文件设置后 Changed 也会变为 true
+	fromArgs := map[string]bool{}
+	for _, value := range values {
+		flag := cmd.Flags().Lookup(value.name)
+		if flag == nil || flag.Name == "config" {
+			return fmt.Errorf("配置文件 %s 中的参数 %s 无效", path, value.name)
+		}
+		fromArgs[flag.Name] = flag.Changed
+	}
+	for _, value := range values {
+		flag := cmd.Flags().Lookup(value.name)
+		if fromArgs[flag.Name] {
+			continue
+		}
+		// 通过 FlagSet 设置以标记为 Changed，与命令行指定的效果一致（例如 --seed、--deadline）
+		if err := cmd.Flags().Set(flag.Name, value.value); err != nil {
+			return fmt.Errorf("配置文件 %s 中的参数 %s 无效，%w", path, value.name, err)
+		}
+	}
+	return nil
+}
+
+type configValue struct {
+	name  string
+	value string
+}
+
+// parseConfig 解析简单的 YAML/TOML 配置，只支持一层的 key: value 或 key = value，
+// 数组可以写成 [a, b] 或者 YAML 的 "- item" 列表，参数名中的下划线等同于中划线，
+// # 开始的注释（包括行尾注释）被忽略，不支持 TOML 的 [section]
+func parseConfig(scanner *bufio.Scanner) ([]configValue, error) {
+	var values []configValue
+	var name string
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(stripComment(scanner.Text()))
+		if text == "" || text == "---" {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			return nil, fmt.Errorf("第 %d 行：不支持 [section]，参数需要写在最外层", line)
+		}
+		if strings.HasPrefix(text, "- ") {
+			if name == "" {
+				return nil, fmt.Errorf("第 %d 行的列表缺少参数名", line)
+			}
+			values = append(values, configValue{name, unquote(text[2:])})
+			continue
+		}
+		i := strings.IndexAny(text, ":=")
+		if i <= 0 {
+			return nil, fmt.Errorf("第 %d 行格式错误", line)
+		}
+		name = strings.ReplaceAll(strings.TrimSpace(text[:i]), "_", "-")
+		value := strings.TrimSpace(text[i+1:])
+		switch {
+		case value == "":
+			// YAML 列表，值在后续的 "- item" 行中
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					values = append(values, configValue{name, unquote(item)})
+				}
+			}
+		default:
+			values = append(values, configValue{name, unquote(value)})
+		}
+	}
+	return values, scanner.Err()
+}
+
+// stripComment 去掉行中 # 开始的注释，引号内的 # 和紧跟在其他字符后的 #（例如网址中的锚点）不是注释
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\'') {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
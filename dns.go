@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/cloverstd/tcping/ping"
+)
+
+// 多个 --dns-server 时选择服务器的策略
+const (
+	dnsStrategyOrder      = "order"       // 按顺序尝试，前面的服务器不可用时才使用后面的
+	dnsStrategyRandom     = "random"      // 每次查询从随机的服务器开始尝试
+	dnsStrategyRoundRobin = "round-robin" // 每次查询从下一个服务器开始尝试
+)
+
+// dnsServers 按策略把查询分散到多个 DNS 服务器
+type dnsServers struct {
+	servers  []string
+	strategy string
+	next     uint32
+}
+
+// newDNSServers 解析 --dns-server，每个参数可以是逗号分隔的多个服务器，未指定端口时使用 53
+func newDNSServers(values []string, strategy string) (*dnsServers, error) {
+	switch strategy {
+	case dnsStrategyOrder, dnsStrategyRandom, dnsStrategyRoundRobin:
+	default:
+		return nil, fmt.Errorf("--dns-strategy 只能是 order、random 或 round-robin")
+	}
+	d := &dnsServers{strategy: strategy}
+	for _, value := range values {
+		for _, server := range strings.Split(value, ",") {
+			if server = strings.TrimSpace(server); server == "" {
+				continue
+			}
+			if _, _, err := net.SplitHostPort(server); err != nil {
+				server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+			}
+			d.servers = append(d.servers, server)
+		}
+	}
+	if len(d.servers) == 0 {
+		return nil, fmt.Errorf("--dns-server 没有指定有效的服务器")
+	}
+	return d, nil
+}
+
+// order 返回本次查询尝试服务器的顺序
+func (d *dnsServers) order() []string {
+	start := 0
+	switch d.strategy {
+	case dnsStrategyRandom:
+		start = ping.RandIntn(len(d.servers))
+	case dnsStrategyRoundRobin:
+		start = int((atomic.AddUint32(&d.next, 1) - 1) % uint32(len(d.servers)))
+	}
+	return append(append([]string{}, d.servers[start:]...), d.servers[:start]...)
+}
+
+// dial 用作 net.Resolver 的 Dial，连接成功的服务器记录到 ctx 中
+func (d *dnsServers) dial(ctx context.Context, network, address string) (conn net.Conn, err error) {
+	var dialer net.Dialer
+	for _, addr := range d.order() {
+		if ctx.Err() != nil {
+			// 探测已停止或超时，不再尝试其他服务器
+			return nil, ctx.Err()
+		}
+		if conn, err = dialer.DialContext(ctx, "udp", addr); err == nil {
+			ping.SetDNSServer(ctx, addr)
+			return conn, nil
+		}
+	}
+	return
+}
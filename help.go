@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloverstd/tcping/ping"
+	"github.com/spf13/cobra"
+)
+
+const tcpHelp = `通过建立 TCP 连接测量延迟，目标可以省略 tcp:// 前缀，tcp4:// 和 tcp6:// 强制使用 IPv4/IPv6。
+
+相关参数：
+  --tls                 连接后尝试 TLS 握手并输出证书信息
+  --payload             每次探测连接后发送数据，通过回显数据测量往返时间
+  --tcp-keepopen        保持连接，通过回显数据测量往返时间（需要 --payload）
+  --connect-timeout     建立连接的超时
+  --read-timeout        读取回显数据的超时
+  --keepalive           开启 TCP keepalive
+  --kernel-rtt          使用内核测得的握手往返时间（仅 Linux）
+
+示例：
+  > tcping google.com
+  > tcping --tls 10.45.52.153 40083
+  > tcping --tcp-keepopen --payload ping 10.45.52.153 7`
+
+const httpHelp = `通过发送 HTTP 请求测量延迟，默认不跟随重定向，h1:// 等同于 http://。
+
+相关参数：
+  --http-method         HTTP 方法，默认 GET
+  --user-agent          自定义 UA
+  --proxy               使用 HTTP 代理
+  --follow-redirects    跟随重定向，最多 --max-redirects 次
+  --meta                输出各阶段耗时
+
+示例：
+  > tcping http://google.com
+  > tcping --proxy http://192.168.3.8:32121 http://google.com`
+
+const httpsHelp = `通过发送 HTTPS 请求测量延迟，参数同 http 协议，h2:// 尝试使用 HTTP/2。
+
+示例：
+  > tcping https://cn.bing.com/
+  > tcping --meta https://cn.bing.com/`
+
+var helpCmd = &cobra.Command{
+	Use:   "help [protocol|command]",
+	Short: "显示帮助信息，例如 tcping help tcp 显示 tcp 协议的用法",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 1 {
+			if protocol, err := ping.NewProtocol(args[0]); err == nil {
+				if spec, ok := ping.LoadSpec(protocol); ok {
+					schemes := append([]string{}, spec.Schemes...)
+					for alias := range spec.Aliases {
+						schemes = append(schemes, alias)
+					}
+					sort.Strings(schemes[len(spec.Schemes):])
+					fmt.Fprintf(cmd.OutOrStdout(), "%s 协议（默认端口 %d）\n\n%s\n", strings.Join(schemes, "|"), spec.DefaultPort, spec.Help)
+					return
+				}
+			}
+		}
+		target, _, err := cmd.Root().Find(args)
+		if target == nil || err != nil {
+			cmd.Printf("未知的协议或命令 %q\n", args)
+			target = cmd.Root()
+		}
+		target.InitDefaultHelpFlag()
+		_ = target.Help()
+	},
+}
+
+func init() {
+	rootCmd.SetHelpCommand(helpCmd)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/cloverstd/tcping/ping"
+	"github.com/mattn/go-runewidth"
+)
+
+// liveTable --live 模式下每个目标占一行，收到探测结果时通过 ANSI 光标移动原地刷新整个表格
+type liveTable struct {
+	mu    sync.Mutex
+	out   io.Writer
+	rows  []*liveRow
+	lines int // 上次输出的行数
+}
+
+type liveRow struct {
+	target string
+	status string
+	rtt    string
+	sent   int
+	failed int
+}
+
+// output 为目标添加一行，返回更新该行的 Outputter
+func (t *liveTable) output(target *url.URL) ping.Outputter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	row := &liveRow{target: target.String(), status: "-", rtt: "-"}
+	t.rows = append(t.rows, row)
+	return &liveOutput{table: t, row: row}
+}
+
+// render 回到表格的第一行后逐行覆盖输出，调用时需要持有锁
+func (t *liveTable) render() {
+	targetWidth := runewidth.StringWidth("TARGET")
+	for _, row := range t.rows {
+		if width := runewidth.StringWidth(row.target); width > targetWidth {
+			targetWidth = width
+		}
+	}
+	var buf bytes.Buffer
+	if t.lines > 0 {
+		_, _ = fmt.Fprintf(&buf, "\x1b[%dA", t.lines)
+	}
+	_, _ = fmt.Fprintf(&buf, "\x1b[2K%s  %s  %s %6s %8s\n",
+		runewidth.FillRight("TARGET", targetWidth), runewidth.FillRight("STATUS", ping.StatusWidth), runewidth.FillRight("RTT", 12), "SENT", "LOSS")
+	for _, row := range t.rows {
+		loss := 0.0
+		if row.sent > 0 {
+			loss = float64(row.failed) / float64(row.sent) * 100
+		}
+		_, _ = fmt.Fprintf(&buf, "\x1b[2K%s  %s  %s %6d %7.1f%%\n",
+			runewidth.FillRight(row.target, targetWidth), runewidth.FillRight(row.status, ping.StatusWidth), runewidth.FillRight(row.rtt, 12), row.sent, loss)
+	}
+	t.lines = len(t.rows) + 1
+	_, _ = t.out.Write(buf.Bytes())
+}
+
+// liveOutput 把一个目标的探测结果写入表格中对应的行
+type liveOutput struct {
+	table *liveTable
+	row   *liveRow
+}
+
+func (o *liveOutput) OnStats(stats *ping.Stats) {
+	o.table.mu.Lock()
+	defer o.table.mu.Unlock()
+	o.row.sent++
+	o.row.rtt = stats.Duration.String()
+	if stats.Error != nil {
+		o.row.failed++
+		o.row.status = "Failed(" + ping.FormatError(stats.Error) + ")"
+	} else {
+		o.row.status = "Connected"
+	}
+	o.table.render()
+}
+
+// OnSummary 表格的最后一次刷新即为结果，不再单独输出统计信息
+func (o *liveOutput) OnSummary(result ping.Result) {}
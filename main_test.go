@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	nethttp "net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloverstd/tcping/ping"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseConfig(t *testing.T) {
+	const config = `
+# 注释
+counter: 10 # 行尾注释
+timeout = "2s"
+http_method: "GET # 引号内不是注释"
+dns_server: [8.8.8.8, '1.1.1.1']
+proxy:
+  - http://127.0.0.1:8080
+`
+	values, err := parseConfig(bufio.NewScanner(strings.NewReader(config)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []configValue{
+		{"counter", "10"},
+		{"timeout", "2s"},
+		{"http-method", "GET # 引号内不是注释"},
+		{"dns-server", "8.8.8.8"},
+		{"dns-server", "1.1.1.1"},
+		{"proxy", "http://127.0.0.1:8080"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("unexpected config values %v", values)
+	}
+}
+
+// configCommand 返回带有部分参数的命令，用于测试配置文件的加载
+func configCommand(t *testing.T, config string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().Int64("seed", 0, "")
+	cmd.Flags().String("deadline", "", "")
+	cmd.Flags().Int("counter", 4, "")
+	cmd.Flags().StringSlice("dns-server", nil, "")
+	path := filepath.Join(t.TempDir(), "tcping.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(cmd, path); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestLoadConfig_Seed(t *testing.T) {
+	cmd := configCommand(t, "seed: 42\ndns_server: [8.8.8.8, 1.1.1.1]\n")
+	// 配置文件中的参数与命令行指定的一样标记为 Changed，--seed 才会生效
+	if !cmd.Flags().Changed("seed") {
+		t.Fatal("seed from the config file should be marked as changed")
+	}
+	if seed, _ := cmd.Flags().GetInt64("seed"); seed != 42 {
+		t.Fatalf("unexpected seed %d", seed)
+	}
+	if servers, _ := cmd.Flags().GetStringSlice("dns-server"); !reflect.DeepEqual(servers, []string{"8.8.8.8", "1.1.1.1"}) {
+		t.Fatalf("unexpected dns servers %v", servers)
+	}
+}
+
+func TestParseConfig_Section(t *testing.T) {
+	if _, err := parseConfig(bufio.NewScanner(strings.NewReader("[tcping]\ncounter = 10\n"))); err == nil {
+		t.Fatal("it should reject TOML sections")
+	}
+}
+
+func TestLoadConfig_Deadline(t *testing.T) {
+	cmd := configCommand(t, "deadline: 1h\n")
+	// 只在配置文件中指定 deadline 时也不限制次数
+	if !cmd.Flags().Changed("deadline") || cmd.Flags().Changed("counter") {
+		t.Fatal("deadline from the config file should be marked as changed")
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		var buf bytes.Buffer
+		rootCmd.SetOut(&buf)
+		rootCmd.SetArgs([]string{"completion", shell})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("%s: %s", shell, err)
+		}
+		if !strings.Contains(buf.String(), "tcping") {
+			t.Fatalf("%s: unexpected completion script %q", shell, buf.String())
+		}
+	}
+	rootCmd.SetOut(nil)
+	rootCmd.SetArgs(nil)
+}
+
+func TestSchemeAliases(t *testing.T) {
+	cases := []struct {
+		target   string
+		protocol ping.Protocol
+		host     string
+		option   ping.Option
+	}{
+		{"h1://example.com", ping.HTTP, "example.com:80", ping.Option{}},
+		{"h2://example.com", ping.HTTPS, "example.com:443", ping.Option{HTTP2: true}},
+		{"tcp4://example.com", ping.TCP, "example.com:80", ping.Option{Network: "tcp4"}},
+		{"tcp6://example.com:22", ping.TCP, "example.com:22", ping.Option{Network: "tcp6"}},
+		{"TCP://example.com", ping.TCP, "example.com:80", ping.Option{}},
+	}
+	for _, c := range cases {
+		var option ping.Option
+		url, protocol, err := parseTarget([]string{c.target}, &option)
+		if err != nil {
+			t.Fatalf("%s: %s", c.target, err)
+		}
+		if protocol != c.protocol || url.Host != c.host || url.Scheme != c.protocol.String() {
+			t.Fatalf("%s: unexpected protocol %s and url %s", c.target, protocol, url)
+		}
+		if !reflect.DeepEqual(option, c.option) {
+			t.Fatalf("%s: unexpected option %+v", c.target, option)
+		}
+	}
+
+	if _, _, err := parseTarget([]string{"h3://example.com"}, &ping.Option{}); err == nil {
+		t.Fatal("h3 should not be supported")
+	}
+}
+
+func TestNagiosReport(t *testing.T) {
+	thresholds := nagiosThresholds{WarnRTT: 10 * time.Millisecond, CritRTT: 50 * time.Millisecond, CritLoss: 50}
+	cases := []struct {
+		result ping.Result
+		code   int
+	}{
+		{ping.Result{Counter: 4, SuccessCounter: 4, TotalDuration: 20 * time.Millisecond}, nagiosOK},
+		{ping.Result{Counter: 4, SuccessCounter: 4, TotalDuration: 80 * time.Millisecond}, nagiosWarning},
+		{ping.Result{Counter: 4, SuccessCounter: 4, TotalDuration: 20 * time.Millisecond, Warnings: 1}, nagiosWarning},
+		{ping.Result{Counter: 4, SuccessCounter: 4, TotalDuration: 400 * time.Millisecond}, nagiosCritical},
+		{ping.Result{Counter: 4, SuccessCounter: 2, TotalDuration: 2 * time.Millisecond}, nagiosCritical},
+		{ping.Result{Counter: 4}, nagiosCritical},
+		{ping.Result{}, nagiosUnknown},
+	}
+	for _, c := range cases {
+		line, code := nagiosReport(c.result, thresholds)
+		if code != c.code {
+			t.Fatalf("unexpected code %d for %q", code, line)
+		}
+		if !strings.HasPrefix(line, nagiosStatus[code]+" - ") {
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+}
+
+func TestTestServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(ln)
+	go func() {
+		_ = server.Serve()
+	}()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	_, _ = conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected echo %q, %v", buf, err)
+	}
+	if elapsed := time.Since(start); elapsed >= sniffTimeout {
+		// 不是请求方法开头的数据不需要等待更多数据
+		t.Fatalf("echo should not wait for sniffing, took %s", elapsed)
+	}
+
+	// 请求行分多段到达时仍然识别为 http 请求
+	split, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer split.Close()
+	_, _ = split.Write([]byte("GE"))
+	time.Sleep(20 * time.Millisecond)
+	_, _ = split.Write([]byte("T /status/204 HTTP/1.1\r\nHost: test\r\n\r\n"))
+	splitResp, err := nethttp.ReadResponse(bufio.NewReader(split), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	splitResp.Body.Close()
+	if splitResp.StatusCode != nethttp.StatusNoContent {
+		t.Fatalf("unexpected status %d", splitResp.StatusCode)
+	}
+
+	resp, err := nethttp.Get("http://" + ln.Addr().String() + "/status/204")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != nethttp.StatusNoContent {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func TestDNSServers(t *testing.T) {
+	servers, err := newDNSServers([]string{"8.8.8.8, 1.1.1.1", "[::1]:5353"}, dnsStrategyRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"8.8.8.8:53", "1.1.1.1:53", "[::1]:5353"}
+	if !reflect.DeepEqual(servers.servers, expected) {
+		t.Fatalf("unexpected servers %v", servers.servers)
+	}
+	for i := 0; i < 4; i++ {
+		if order := servers.order(); order[0] != expected[i%3] || len(order) != 3 {
+			t.Fatalf("unexpected order %v", order)
+		}
+	}
+	if _, err := newDNSServers(nil, "fastest"); err == nil {
+		t.Fatal("it should reject unknown strategy")
+	}
+	if _, err := newDNSServers([]string{",", " , "}, dnsStrategyRoundRobin); err == nil {
+		t.Fatal("it should reject empty servers")
+	}
+}
+
+func TestWaitResolve(t *testing.T) {
+	// 解析器无法连接 DNS 服务器，只有 hosts 文件中的名字能够解析
+	option := ping.Option{
+		Timeout: time.Second,
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return nil, errors.New("dns is down")
+			},
+		},
+	}
+	stopC := make(chan struct{})
+	for _, target := range []string{"127.0.0.1", "localhost"} {
+		if err := waitResolve([]string{target, "80"}, option, time.Second, stopC); err != nil {
+			t.Fatalf("%s: %s", target, err)
+		}
+	}
+	start := time.Now()
+	if err := waitResolve([]string{"tcping.invalid", "80"}, option, 300*time.Millisecond, stopC); err == nil {
+		t.Fatal("it should time out")
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("unexpected wait %s", elapsed)
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	for port, expected := range map[string]int{"8080": 8080, "http": 80, "https": 443, "ssh": 22, "smtp": 25} {
+		if got, err := parsePort(port); err != nil || got != expected {
+			t.Fatalf("%s: unexpected port %d, %v", port, got, err)
+		}
+	}
+	if _, err := parsePort("no-such-service"); err == nil {
+		t.Fatal("it should reject unknown service")
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := parseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "tls_rsa_with_rc4_128_sha"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_RC4_128_SHA}) {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+	for _, name := range []string{"TLS_AES_128_GCM_SHA256", "NO_SUCH_CIPHER"} {
+		if _, err := parseCipherSuites([]string{name}); err == nil {
+			t.Fatalf("%s: it should be rejected", name)
+		}
+	}
+}
+
+func TestLookupSRV(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var parser dnsmessage.Parser
+			header, err := parser.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			question, err := parser.Question()
+			if err != nil {
+				continue
+			}
+			builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RecursionAvailable: true})
+			_ = builder.StartQuestions()
+			_ = builder.Question(question)
+			_ = builder.StartAnswers()
+			rr := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+			for _, srv := range []dnsmessage.SRVResource{
+				{Priority: 20, Weight: 1, Port: 5270, Target: dnsmessage.MustNewName("backup.example.com.")},
+				{Priority: 10, Weight: 1, Port: 5269, Target: dnsmessage.MustNewName("xmpp.example.com.")},
+			} {
+				_ = builder.SRVResource(rr, srv)
+			}
+			msg, _ := builder.Finish()
+			_, _ = conn.WriteTo(msg, addr)
+		}
+	}()
+
+	option := ping.Option{Resolver: &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	target, err := lookupSRV(ctx, option, "_xmpp-server._tcp.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "xmpp.example.com:5269" {
+		t.Fatalf("unexpected target %s", target)
+	}
+}
+
+func TestDryRun_SchemeAlias(t *testing.T) {
+	// tcp6:// 只影响自己的目标，之后的 IPv4 地址仍然可以解析
+	if !dryRun([][]string{{"tcp6://[::1]"}, {"127.0.0.1"}}, ping.Option{Timeout: time.Second}) {
+		t.Fatal("the scheme alias should not carry over to the next target")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloverstd/tcping/ping"
+)
+
+// Nagios 插件约定的退出码
+const (
+	nagiosOK = iota
+	nagiosWarning
+	nagiosCritical
+	nagiosUnknown
+)
+
+var nagiosStatus = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// nagiosThresholds --nagios 模式的告警阈值，0 表示不检查
+type nagiosThresholds struct {
+	WarnRTT  time.Duration
+	CritRTT  time.Duration
+	CritLoss float64 // 丢包率，单位为百分比
+}
+
+// nagiosReport 按阈值把统计结果格式化为一行 Nagios 状态（附带性能数据），返回状态行和退出码，全部失败时为 CRITICAL，
+// 有带警告的成功探测时至少为 WARNING
+func nagiosReport(result ping.Result, t nagiosThresholds) (string, int) {
+	if result.Counter == 0 {
+		return "UNKNOWN - 没有执行任何探测", nagiosUnknown
+	}
+	rtt := result.Avg()
+	loss := float64(result.Failed()) / float64(result.Counter) * 100
+
+	code := nagiosOK
+	switch {
+	case result.SuccessCounter == 0,
+		t.CritLoss > 0 && loss >= t.CritLoss,
+		t.CritRTT > 0 && rtt >= t.CritRTT:
+		code = nagiosCritical
+	case t.WarnRTT > 0 && rtt >= t.WarnRTT,
+		result.Warnings > 0: // 例如证书即将过期
+		code = nagiosWarning
+	}
+	line := fmt.Sprintf("%s - rtt=%s loss=%.1f%% | rtt=%.3fms;%s;%s;0 loss=%.1f%%;;%s;0;100",
+		nagiosStatus[code], rtt, loss,
+		float64(rtt)/float64(time.Millisecond), nagiosMillis(t.WarnRTT), nagiosMillis(t.CritRTT),
+		loss, nagiosPercent(t.CritLoss))
+	return line, code
+}
+
+// nagiosMillis 性能数据中阈值的毫秒数，未设置时为空
+func nagiosMillis(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.3f", float64(d)/float64(time.Millisecond))
+}
+
+// nagiosPercent 性能数据中阈值的百分比，未设置时为空
+func nagiosPercent(v float64) string {
+	if v <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+// runNagios 执行 Pinger 直到完成或收到停止信号，只输出一行 Nagios 状态，返回退出码
+func runNagios(pinger *ping.Pinger, stopC <-chan struct{}, t nagiosThresholds) int {
+	go pinger.Ping()
+	select {
+	case <-stopC:
+	case <-pinger.Done():
+	}
+	pinger.Stop()
+	if pinger.DrainOnStop {
+		<-pinger.Finished()
+	}
+	line, code := nagiosReport(pinger.Statistics(), t)
+	fmt.Println(line)
+	return code
+}
+
+// parseNagiosThresholds 解析 --warn-rtt/--crit-rtt/--crit-loss
+func parseNagiosThresholds() (nagiosThresholds, error) {
+	t := nagiosThresholds{CritLoss: critLoss}
+	var err error
+	if warnRTT != "" {
+		if t.WarnRTT, err = ping.ParseDuration(warnRTT); err != nil {
+			return t, fmt.Errorf("解析 --warn-rtt 失败，%w", err)
+		}
+	}
+	if critRTT != "" {
+		if t.CritRTT, err = ping.ParseDuration(critRTT); err != nil {
+			return t, fmt.Errorf("解析 --crit-rtt 失败，%w", err)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,50 @@
+package ping
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Score 比较多个目标时的综合得分（毫秒，越小越好）：平均往返时间除以成功率，即每次成功探测的期望耗时，
+// 再除以目标的权重，权重越大的目标越优先，没有成功的探测时返回 +Inf
+func (result Result) Score() float64 {
+	if result.SuccessCounter == 0 || result.Counter == 0 {
+		return math.Inf(1)
+	}
+	weight := 1.0
+	if result.Target != nil && result.Target.Weight > 0 {
+		weight = result.Target.Weight
+	}
+	rate := float64(result.SuccessCounter) / float64(result.Counter)
+	return float64(result.Avg()) / float64(time.Millisecond) / rate / weight
+}
+
+// CompareText 按综合得分从小到大列出各目标的比较结果，得分相同时保持输入的顺序
+func CompareText(results []Result) string {
+	sorted := append([]Result{}, results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Score() < sorted[j].Score()
+	})
+	var buf bytes.Buffer
+	_, _ = fmt.Fprint(&buf, "\nComparison (score = avg / success rate / weight, lower is better):")
+	for i, result := range sorted {
+		target, weight := "", 1.0
+		if result.Target != nil {
+			target = result.Target.String()
+			if result.Target.Weight > 0 {
+				weight = result.Target.Weight
+			}
+		}
+		score := "n/a"
+		if s := result.Score(); !math.IsInf(s, 1) {
+			score = fmt.Sprintf("%.3f", s)
+		}
+		_, _ = fmt.Fprintf(&buf, "\n\t%d. %s weight=%g avg=%s loss=%.1f%% score=%s",
+			i+1, target, weight, result.Avg(), result.LossPct, score)
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
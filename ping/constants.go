@@ -7,3 +7,19 @@ const (
 	DefaultInterval = time.Second
 	DefaultTimeout  = time.Second * 5
 )
+
+// tcp 探测关闭连接的方式
+const (
+	// CloseFIN 正常关闭，发送 FIN，对服务器更友好
+	CloseFIN = "fin"
+	// CloseRST 设置 SO_LINGER 为 0 后关闭，直接发送 RST，不在本地留下 TIME_WAIT，但部分服务器会记录异常断开的日志
+	CloseRST = "rst"
+)
+
+// tcp 探测连接后发送的 PROXY protocol 头的版本
+const (
+	// ProxyProtocolV1 文本格式
+	ProxyProtocolV1 = "v1"
+	// ProxyProtocolV2 二进制格式
+	ProxyProtocolV2 = "v2"
+)
@@ -0,0 +1,94 @@
+package ping
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"time"
+)
+
+// Debugf 在 Option.Verbose 不小于 level 时向 DebugOut（默认标准错误）输出一行调试信息，
+// level 1 输出各阶段的结果和耗时，level 2 同时输出各阶段的开始
+func (op *Option) Debugf(level int, format string, args ...interface{}) {
+	if op.Verbose < level {
+		return
+	}
+	out := op.DebugOut
+	if out == nil {
+		out = os.Stderr
+	}
+	_, _ = fmt.Fprintf(out, "%s debug: %s\n", time.Now().Format("15:04:05.000"), fmt.Sprintf(format, args...))
+}
+
+// WithDebugTrace 在 Option.Verbose 大于 0 时为 ctx 添加输出 DNS、连接、TLS 各阶段调试信息的 ClientTrace，
+// 与 ctx 中已有的 ClientTrace 同时生效
+func WithDebugTrace(ctx context.Context, op *Option, target string) context.Context {
+	if op.Verbose <= 0 {
+		return ctx
+	}
+	var mu sync.Mutex
+	var dnsStart, tlsStart time.Time
+	// 同时连接多个地址时按地址记录开始时间
+	connectStart := map[string]time.Time{}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = time.Now()
+			mu.Unlock()
+			op.Debugf(2, "%s dns start host=%s", target, info.Host)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			mu.Lock()
+			d := time.Since(dnsStart)
+			mu.Unlock()
+			op.Debugf(1, "%s dns done in %s addrs=%v err=%v", target, d, info.Addrs, info.Err)
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			connectStart[addr] = time.Now()
+			mu.Unlock()
+			op.Debugf(2, "%s connect start %s %s", target, network, addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			d := time.Since(connectStart[addr])
+			mu.Unlock()
+			op.Debugf(1, "%s connect done in %s %s %s err=%v", target, d, network, addr, err)
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsStart = time.Now()
+			mu.Unlock()
+			op.Debugf(2, "%s tls start", target)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			mu.Lock()
+			d := time.Since(tlsStart)
+			mu.Unlock()
+			op.Debugf(1, "%s tls done in %s version=%s err=%v", target, d, TLSVersionName(state.Version), err)
+		},
+		GotFirstResponseByte: func() {
+			op.Debugf(1, "%s got first response byte", target)
+		},
+	})
+}
+
+// TLSVersionName 返回 TLS 版本的名称，例如 TLS1.3
+func TLSVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS1.0"
+	case tls.VersionTLS11:
+		return "TLS1.1"
+	case tls.VersionTLS12:
+		return "TLS1.2"
+	case tls.VersionTLS13:
+		return "TLS1.3"
+	case 0:
+		return "none"
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
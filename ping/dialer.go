@@ -0,0 +1,117 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// NewDialer 根据选项创建探测使用的 Dialer，指定 Interface 时绑定到该网卡
+func NewDialer(op *Option) (*net.Dialer, error) {
+	dialer := &net.Dialer{
+		Resolver: op.Resolver,
+	}
+	if op.Interface != "" {
+		if err := bindInterface(dialer, op.Interface, op.DialNetwork()); err != nil {
+			return nil, err
+		}
+	}
+	if op.BindPort != 0 {
+		if op.BindPort < 0 || op.BindPort > 65535 {
+			return nil, fmt.Errorf("本地端口的取值范围是 1-65535")
+		}
+		// 与绑定网卡时设置的源地址合并
+		local, _ := dialer.LocalAddr.(*net.TCPAddr)
+		if local == nil {
+			local = &net.TCPAddr{}
+		}
+		local.Port = op.BindPort
+		dialer.LocalAddr = local
+	}
+	if op.FastOpen {
+		setFastOpen(dialer)
+	}
+	if op.DSCP != 0 {
+		if op.DSCP < 0 || op.DSCP > 63 {
+			return nil, fmt.Errorf("DSCP 的取值范围是 0-63")
+		}
+		if err := setDSCP(dialer, op.DSCP); err != nil {
+			return nil, err
+		}
+	}
+	return dialer, nil
+}
+
+// addControl 在 Dialer 已有的 Control 之后追加对套接字的设置
+func addControl(dialer *net.Dialer, fn func(network string, fd uintptr) error) {
+	prev := dialer.Control
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		if prev != nil {
+			if err := prev(network, address, c); err != nil {
+				return err
+			}
+		}
+		var fnErr error
+		if err := c.Control(func(fd uintptr) {
+			fnErr = fn(network, fd)
+		}); err != nil {
+			return err
+		}
+		return fnErr
+	}
+}
+
+// dnsBackoff 域名解析重试的退避间隔，第 n 次重试前等待 n 倍的间隔
+const dnsBackoff = 100 * time.Millisecond
+
+// DialContext 连接 addr，Option.DNSRetries 大于 0 且 addr 为域名时先解析域名，解析失败时退避重试，
+// 然后依次连接解析到的地址，返回的 attempts 为解析的尝试次数，未单独解析时为 0
+func DialContext(ctx context.Context, dialer *net.Dialer, op *Option, addr string) (conn net.Conn, attempts int, err error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || op.DNSRetries <= 0 || net.ParseIP(host) != nil {
+		conn, err = dialer.DialContext(ctx, op.DialNetwork(), addr)
+		return conn, 0, bindError(op, err)
+	}
+	resolver := dialer.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	var ips []net.IP
+	for attempts < op.DNSRetries+1 {
+		if attempts > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, attempts, err
+			case <-time.After(time.Duration(attempts) * dnsBackoff):
+			}
+		}
+		attempts++
+		ips, err = resolver.LookupIP(ctx, op.LookupNetwork(), host)
+		var dnsErr *net.DNSError
+		if err == nil || (errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			// 域名不存在不是偶发的错误，不再重试
+			break
+		}
+	}
+	if err != nil {
+		return nil, attempts, err
+	}
+	for _, ip := range ips {
+		conn, err = dialer.DialContext(ctx, op.DialNetwork(), net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, attempts, nil
+		}
+	}
+	return nil, attempts, bindError(op, err)
+}
+
+// bindError 指定的本地端口被占用时返回更明确的错误
+func bindError(op *Option, err error) error {
+	if op.BindPort != 0 && errors.Is(err, syscall.EADDRINUSE) {
+		return fmt.Errorf("本地端口 %d 已被占用（上一次探测的连接可能仍处于 TIME_WAIT，tcp 模式可以配合 --tcp-close-mode rst 使用），%w", op.BindPort, err)
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+//go:build linux
+
+package ping
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// setFastOpen 通过 TCP_FASTOPEN_CONNECT 开启 TCP Fast Open，连接在第一次写入时才发送 SYN 并携带数据
+func setFastOpen(dialer *net.Dialer) {
+	addControl(dialer, func(network string, fd uintptr) error {
+		// 内核不支持时忽略，按普通连接处理
+		_ = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN_CONNECT, 1)
+		return nil
+	})
+}
+
+// bindInterface 通过 SO_BINDTODEVICE 把连接绑定到网卡
+func bindInterface(dialer *net.Dialer, name, network string) error {
+	if _, err := net.InterfaceByName(name); err != nil {
+		return fmt.Errorf("网卡 %s 不存在，%w", name, err)
+	}
+	addControl(dialer, func(network string, fd uintptr) error {
+		if err := unix.BindToDevice(int(fd), name); err != nil {
+			return fmt.Errorf("绑定网卡 %s 失败，%w", name, err)
+		}
+		return nil
+	})
+	return nil
+}
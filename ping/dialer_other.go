@@ -0,0 +1,43 @@
+//go:build !linux
+
+package ping
+
+import (
+	"fmt"
+	"net"
+)
+
+// setFastOpen 当前平台不支持 TCP Fast Open，按普通连接处理
+func setFastOpen(dialer *net.Dialer) {}
+
+// bindInterface 使用网卡的地址作为连接的源地址，不支持查询网卡的平台返回错误
+func bindInterface(dialer *net.Dialer, name, network string) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("当前平台不支持绑定网卡或网卡 %s 不存在，%w", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return fmt.Errorf("读取网卡 %s 的地址失败，%w", name, err)
+	}
+	var ip net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		isV4 := ipNet.IP.To4() != nil
+		if (network == "tcp4" && !isV4) || (network == "tcp6" && isV4) {
+			continue
+		}
+		// 未指定网络时优先使用 IPv4 地址
+		if ip == nil || (isV4 && ip.To4() == nil) {
+			ip = ipNet.IP
+		}
+	}
+	if ip == nil {
+		return fmt.Errorf("网卡 %s 没有可用的 %s 地址", name, network)
+	}
+	dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	return nil
+}
@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cloverstd/tcping/ping"
+)
+
+var _ ping.Ping = (*Ping)(nil)
+
+// New 创建只解析域名不建立连接的执行器，每次探测通过 Option.Resolver（未设置时使用系统解析器）解析 host，
+// 往返时间为解析的耗时，解析到地址时认为成功
+func New(host string, op *ping.Option) *Ping {
+	return &Ping{
+		host:   host,
+		option: op,
+	}
+}
+
+type Ping struct {
+	host   string
+	option *ping.Option
+}
+
+func (p *Ping) Ping(ctx context.Context) *ping.Stats {
+	timeout := ping.DefaultTimeout
+	if p.option.Timeout > 0 {
+		timeout = p.option.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stats := ping.Stats{
+		Meta: map[string]fmt.Stringer{},
+	}
+	resolver := p.option.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ctx, dnsServer := ping.WithDNSServer(ctx)
+	start := time.Now()
+	ips, err := resolver.LookupIP(ctx, p.option.LookupNetwork(), p.host)
+	stats.DNSDuration = time.Since(start)
+	stats.Duration = stats.DNSDuration
+	if server := dnsServer(); server != "" {
+		stats.Meta["dns_server"] = String(server)
+	}
+	if err != nil {
+		stats.Error = err
+		return &stats
+	}
+	if len(ips) == 0 {
+		stats.Error = fmt.Errorf("域名 %s 没有解析到地址", p.host)
+		return &stats
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	stats.Address = addrs[0]
+	stats.Meta["addrs"] = String(strings.Join(addrs, ","))
+	stats.Connected = true
+	return &stats
+}
+
+type String string
+
+func (s String) String() string {
+	return string(s)
+}
@@ -0,0 +1,27 @@
+package dns_test
+
+import (
+	"context"
+	"testing"
+
+	tcping "github.com/cloverstd/tcping/ping"
+	"github.com/cloverstd/tcping/ping/dns"
+)
+
+func TestPing(t *testing.T) {
+	stats := dns.New("localhost", &tcping.Option{Network: "tcp4"}).Ping(context.Background())
+	if !stats.Connected {
+		t.Fatal(stats.Error)
+	}
+	if stats.Address != "127.0.0.1" || stats.DNSDuration != stats.Duration {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if got := stats.Meta["addrs"]; got == nil || got.String() != "127.0.0.1" {
+		t.Fatalf("unexpected addrs %v", got)
+	}
+
+	stats = dns.New("tcping.invalid", &tcping.Option{}).Ping(context.Background())
+	if stats.Connected || stats.Error == nil {
+		t.Fatal("it should fail to resolve")
+	}
+}
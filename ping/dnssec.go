@@ -0,0 +1,137 @@
+package ping
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// typeRRSIG DNSSEC 签名记录的类型，dnsmessage 没有定义
+const typeRRSIG dnsmessage.Type = 46
+
+// DNSSECResult 一次带 DO 标志的查询结果
+type DNSSECResult struct {
+	AD     bool // 应答的 AD（authenticated data）标志，递归服务器验证了签名时置位
+	Signed bool // 应答中带有 RRSIG 记录
+}
+
+// CheckDNSSEC 向解析器使用的 DNS 服务器查询 host，查询设置 DO 和 AD 标志，返回应答是否经过验证和是否带有签名，
+// 使用自定义解析器（--dns-server）时通过它的 Dial 连接，否则使用系统配置的第一个 DNS 服务器
+func (op *Option) CheckDNSSEC(ctx context.Context, host string) (DNSSECResult, error) {
+	var result DNSSECResult
+	name, err := dnsmessage.NewName(dnsName(host))
+	if err != nil {
+		return result, err
+	}
+	qtype := dnsmessage.TypeA
+	if op.LookupNetwork() == "ip6" {
+		qtype = dnsmessage.TypeAAAA
+	}
+	id := uint16(RandIntn(1 << 16))
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true, AuthenticData: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return result, err
+	}
+	if err := builder.Question(dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return result, err
+	}
+	if err := builder.StartAdditionals(); err != nil {
+		return result, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(4096, dnsmessage.RCodeSuccess, true); err != nil {
+		return result, err
+	}
+	if err := builder.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return result, err
+	}
+	query, err := builder.Finish()
+	if err != nil {
+		return result, err
+	}
+
+	dial := (&net.Dialer{}).DialContext
+	if op.Resolver != nil && op.Resolver.Dial != nil {
+		dial = op.Resolver.Dial
+	}
+	conn, err := dial(ctx, "udp", systemDNSServer())
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return result, err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return result, err
+		}
+		var parser dnsmessage.Parser
+		header, err := parser.Start(buf[:n])
+		if err != nil || header.ID != id || !header.Response {
+			// 忽略不属于本次查询的数据
+			continue
+		}
+		if header.RCode != dnsmessage.RCodeSuccess {
+			return result, fmt.Errorf("DNS 查询失败，%s", header.RCode)
+		}
+		result.AD = header.AuthenticData
+		if err := parser.SkipAllQuestions(); err != nil {
+			return result, err
+		}
+		for {
+			answer, err := parser.AnswerHeader()
+			if errors.Is(err, dnsmessage.ErrSectionDone) {
+				break
+			}
+			if err != nil {
+				return result, err
+			}
+			if answer.Type == typeRRSIG {
+				result.Signed = true
+			}
+			if err := parser.SkipAnswer(); err != nil {
+				return result, err
+			}
+		}
+		return result, nil
+	}
+}
+
+// dnsName 返回以点结尾的完整域名
+func dnsName(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
+
+// systemDNSServer 返回 /etc/resolv.conf 中的第一个 DNS 服务器，读取失败时使用本机
+func systemDNSServer() string {
+	server := "127.0.0.1"
+	f, err := os.Open("/etc/resolv.conf")
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				server = fields[1]
+				break
+			}
+		}
+	}
+	return net.JoinHostPort(server, "53")
+}
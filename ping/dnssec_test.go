@@ -0,0 +1,71 @@
+package ping_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	tcping "github.com/cloverstd/tcping/ping"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serveDNSSEC 启动只应答一次的 DNS 服务器，signed 为 true 时应答带有 AD 标志和 RRSIG 记录
+func serveDNSSEC(t *testing.T, signed bool) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var parser dnsmessage.Parser
+		header, err := parser.Start(buf[:n])
+		if err != nil {
+			return
+		}
+		question, err := parser.Question()
+		if err != nil {
+			return
+		}
+		builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, AuthenticData: signed})
+		_ = builder.StartQuestions()
+		_ = builder.Question(question)
+		_ = builder.StartAnswers()
+		rr := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+		_ = builder.AResource(rr, dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})
+		if signed {
+			rr.Type = 46
+			_ = builder.UnknownResource(rr, dnsmessage.UnknownResource{Type: 46, Data: []byte{0}})
+		}
+		msg, _ := builder.Finish()
+		_, _ = conn.WriteTo(msg, addr)
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestOption_CheckDNSSEC(t *testing.T) {
+	for _, signed := range []bool{true, false} {
+		server := serveDNSSEC(t, signed)
+		op := &tcping.Option{Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "udp", server)
+			},
+		}}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		result, err := op.CheckDNSSEC(ctx, "example.com")
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.AD != signed || result.Signed != signed {
+			t.Fatalf("signed=%t: unexpected result %+v", signed, result)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package ping
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+type dnsServerKey struct{}
+
+type dnsServerRecorder struct {
+	mu      sync.Mutex
+	servers []string
+}
+
+// WithDNSServer 返回记录自定义解析器所用 DNS 服务器的 ctx，以及读取记录结果的函数，
+// 解析器的 Dial 通过 SetDNSServer 写入，一次解析（例如同时查询 A 和 AAAA 记录）用到多个服务器时按使用的顺序以逗号分隔
+func WithDNSServer(ctx context.Context) (context.Context, func() string) {
+	recorder := &dnsServerRecorder{}
+	return context.WithValue(ctx, dnsServerKey{}, recorder), func() string {
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		return strings.Join(recorder.servers, ",")
+	}
+}
+
+// SetDNSServer 在 ctx 中记录本次查询使用的 DNS 服务器，ctx 不是由 WithDNSServer 创建时忽略
+func SetDNSServer(ctx context.Context, server string) {
+	if recorder, ok := ctx.Value(dnsServerKey{}).(*dnsServerRecorder); ok {
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		for _, s := range recorder.servers {
+			if s == server {
+				return
+			}
+		}
+		recorder.servers = append(recorder.servers, server)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package ping
+
+import (
+	"fmt"
+	"net"
+)
+
+// setDSCP 当前平台不支持设置 DSCP
+func setDSCP(dialer *net.Dialer, dscp int) error {
+	return fmt.Errorf("当前平台不支持设置 DSCP")
+}
@@ -0,0 +1,28 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package ping
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// setDSCP 通过 IP_TOS（IPv6 为 IPV6_TCLASS）设置连接的 DSCP 标记
+func setDSCP(dialer *net.Dialer, dscp int) error {
+	tos := dscp << 2
+	addControl(dialer, func(network string, fd uintptr) error {
+		var err error
+		if network == "tcp6" {
+			err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS, tos)
+		} else {
+			err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS, tos)
+		}
+		if err != nil {
+			return fmt.Errorf("设置 DSCP 失败，%w", err)
+		}
+		return nil
+	})
+	return nil
+}
@@ -0,0 +1,100 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloverstd/tcping/ping"
+)
+
+var _ ping.Ping = (*Ping)(nil)
+
+// New 创建通过外部程序探测的执行器，每次探测执行 path host port，
+// 退出码 0 表示成功，标准输出的第一个字段为往返时间（毫秒），没有输出时使用执行程序的耗时
+func New(path string, host string, port int, op *ping.Option) *Ping {
+	return &Ping{
+		path:   path,
+		host:   host,
+		port:   port,
+		option: op,
+	}
+}
+
+type Ping struct {
+	path   string
+	host   string
+	port   int
+	option *ping.Option
+}
+
+func (p *Ping) Ping(ctx context.Context) *ping.Stats {
+	timeout := ping.DefaultTimeout
+	if p.option.Timeout > 0 {
+		timeout = p.option.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stats ping.Stats
+	port := strconv.Itoa(p.port)
+	cmd := exec.Command(p.path, p.host, port)
+	cmd.Env = append(os.Environ(), "TCPING_HOST="+p.host, "TCPING_PORT="+port)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	stats.Address = net.JoinHostPort(p.host, port)
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		stats.Error = err
+		return &stats
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// 程序的子进程可能仍然持有输出管道，不等待 Wait 返回，直接按超时或停止处理
+		_ = cmd.Process.Kill()
+		stats.Duration = time.Since(start)
+		stats.Error = ctx.Err()
+		return &stats
+	}
+	stats.Duration = time.Since(start)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("探测程序退出码 %d", exitErr.ExitCode())
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				err = fmt.Errorf("%w：%s", err, strings.SplitN(msg, "\n", 2)[0])
+			}
+		}
+		stats.Error = err
+		return &stats
+	}
+	stats.Connected = true
+	stats.Meta = map[string]fmt.Stringer{"rtt_source": String("wallclock")}
+	if fields := strings.Fields(stdout.String()); len(fields) > 0 {
+		if ms, err := strconv.ParseFloat(fields[0], 64); err == nil && ms >= 0 {
+			stats.Duration = time.Duration(ms * float64(time.Millisecond))
+			stats.Meta["rtt_source"] = String("exec")
+		}
+	}
+	return &stats
+}
+
+type String string
+
+func (s String) String() string {
+	return string(s)
+}
@@ -0,0 +1,64 @@
+package exec_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	tcping "github.com/cloverstd/tcping/ping"
+	"github.com/cloverstd/tcping/ping/exec"
+)
+
+// script 写入一个 shell 脚本作为探测程序
+func script(t *testing.T, body string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on windows")
+	}
+	path := filepath.Join(t.TempDir(), "probe.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPing(t *testing.T) {
+	path := script(t, `[ "$1" = "::1" ] && [ "$TCPING_PORT" = "22" ] && echo 12.5`)
+	stats := exec.New(path, "::1", 22, &tcping.Option{}).Ping(context.Background())
+	if !stats.Connected {
+		t.Fatal(stats.Error)
+	}
+	if stats.Duration != 12500*time.Microsecond || stats.Meta["rtt_source"].String() != "exec" {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.Address != "[::1]:22" {
+		t.Fatalf("unexpected address %s", stats.Address)
+	}
+}
+
+func TestPing_ExitCode(t *testing.T) {
+	path := script(t, "echo refused >&2\nexit 3")
+	stats := exec.New(path, "127.0.0.1", 80, &tcping.Option{}).Ping(context.Background())
+	if stats.Connected || stats.Error == nil {
+		t.Fatal("it should fail with a non-zero exit code")
+	}
+	if msg := stats.Error.Error(); !strings.Contains(msg, "退出码 3") || !strings.Contains(msg, "refused") {
+		t.Fatalf("unexpected error %q", msg)
+	}
+}
+
+func TestPing_Timeout(t *testing.T) {
+	path := script(t, "sleep 5")
+	start := time.Now()
+	stats := exec.New(path, "127.0.0.1", 80, &tcping.Option{Timeout: 100 * time.Millisecond}).Ping(context.Background())
+	if !errors.Is(stats.Error, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error %v", stats.Error)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("it should not wait for the program, %s", elapsed)
+	}
+}
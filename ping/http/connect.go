@@ -0,0 +1,81 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/cloverstd/tcping/ping"
+)
+
+// connect 只建立到目标的连接，https 还会完成 TLS 握手，不发送请求
+func (p *Ping) connect(ctx context.Context, stats *ping.Stats, trace *Trace) {
+	conn, err := p.dial(ctx, "tcp", canonicalAddr(p.target))
+	stats.DNSDuration = trace.DNSDuration
+	stats.Address = trace.address
+	if err != nil {
+		stats.Error = err
+		return
+	}
+	defer conn.Close()
+	stats.Meta["connect"] = trace.ConnectDuration
+	if p.target.Scheme != "https" {
+		stats.Connected = true
+		return
+	}
+
+	// TLS 握手不经过 Transport，需要自己触发握手事件
+	hooks := httptrace.ContextClientTrace(ctx)
+	config := &tls.Config{}
+	if p.option.TLSConfig != nil {
+		config = p.option.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = p.target.Hostname()
+	}
+	if hooks != nil && hooks.TLSHandshakeStart != nil {
+		hooks.TLSHandshakeStart()
+	}
+	tlsConn := tls.Client(conn, config)
+	err = tlsConn.HandshakeContext(ctx)
+	state := tlsConn.ConnectionState()
+	if hooks != nil && hooks.TLSHandshakeDone != nil {
+		hooks.TLSHandshakeDone(state, err)
+	}
+	if err != nil {
+		stats.Error = fmt.Errorf("TLS 握手失败， %w", err)
+		return
+	}
+	stats.Meta["tls"] = trace.TLSDuration
+	stats.Meta["tls_version"] = String(ping.TLSVersionName(state.Version))
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		stats.Meta["cert_subject"] = String(leaf.Subject.CommonName)
+		stats.Meta["cert_not_after"] = String(leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	p.tlsMeta(stats, &state)
+	stats.Connected = true
+}
+
+// tlsMeta 记录证书有效期和 ALPN 协商结果，完整请求和 --connect-only 共用
+func (p *Ping) tlsMeta(stats *ping.Stats, state *tls.ConnectionState) {
+	if len(state.PeerCertificates) > 0 && p.option.CertWarnDays > 0 {
+		days, expiring := p.option.CertExpiring(state.PeerCertificates[0].NotAfter, time.Now())
+		stats.Meta["cert_days_left"] = Int(days)
+		if expiring {
+			stats.Meta["cert_expiring"] = String("true")
+			stats.Warning = fmt.Sprintf("证书 %d 天后过期", days)
+		}
+	}
+	if config := p.option.TLSConfig; config != nil && len(config.NextProtos) > 0 {
+		stats.Meta["alpn"] = String(alpnResult(state.NegotiatedProtocol))
+	}
+	if config := p.option.TLSConfig; config != nil && (config.MinVersion != 0 || config.MaxVersion != 0) {
+		stats.Meta["tls_version"] = String(ping.TLSVersionName(state.Version))
+	}
+	if config := p.option.TLSConfig; config != nil && len(config.CipherSuites) > 0 {
+		stats.Meta["tls_cipher"] = String(tls.CipherSuiteName(state.CipherSuite))
+	}
+}
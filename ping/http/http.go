@@ -1,6 +1,7 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -8,59 +9,170 @@ import (
 	"net/http"
 	pkgurl "net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cloverstd/tcping/ping"
+	"golang.org/x/net/http/httpproxy"
 )
 
 var _ ping.Ping = (*Ping)(nil)
 
+// DefaultMaxRedirects 跟随重定向时默认的最大次数
+const DefaultMaxRedirects = 10
+
+// redirectsKey 在请求的 context 中记录本次探测的重定向次数
+type redirectsKey struct{}
+
+// dnsAttemptsKey 在请求的 context 中记录连接目标时域名解析的尝试次数
+type dnsAttemptsKey struct{}
+
 func New(method string, url string, op *ping.Option, trace bool) (*Ping, error) {
 
-	_, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("网址或方法无效, %w", err)
 	}
+	host := req.URL.Hostname()
 
 	if method == "" {
 		method = http.MethodGet
 	}
 
+	dialer, err := ping.NewDialer(op)
+	if err != nil {
+		return nil, err
+	}
+	if op.ConnectOnly && op.Proxy != nil {
+		return nil, fmt.Errorf("--connect-only 不支持通过代理连接")
+	}
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// 指定固定地址时只替换到目标的连接，到代理的连接不受影响
+		h, port, err := net.SplitHostPort(addr)
+		if err == nil && op.IP != "" && h == host {
+			addr = net.JoinHostPort(op.IP, port)
+		}
+		if op.Tunnel != nil {
+			return op.Tunnel(ctx, op.DialNetwork(), addr)
+		}
+		conn, attempts, err := ping.DialContext(ctx, dialer, op, addr)
+		if dnsAttempts, ok := ctx.Value(dnsAttemptsKey{}).(*int); ok && h == host {
+			*dnsAttempts = attempts
+		}
+		return conn, err
+	}
+	proxy := proxyFunc(op)
+	transportDial := dial
+	var connPool *pool
+	if op.HTTPMaxIdleConns > 0 {
+		connPool = &pool{maxIdle: op.HTTPMaxIdleConns}
+		transportDial = connPool.wrap(dial)
+	}
 	return &Ping{
+		proxy:  proxy,
 		url:    url,
+		target: req.URL,
 		method: method,
 		trace:  trace,
 		option: op,
+		dial:   dial,
+		pool:   connPool,
 		client: &http.Client{
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				// disable redirect
-				return http.ErrUseLastResponse
+				if !op.FollowRedirects {
+					// disable redirect
+					return http.ErrUseLastResponse
+				}
+				if redirects, ok := req.Context().Value(redirectsKey{}).(*int); ok {
+					*redirects = len(via)
+				}
+				maxRedirects := op.MaxRedirects
+				if maxRedirects <= 0 {
+					maxRedirects = DefaultMaxRedirects
+				}
+				if len(via) > maxRedirects {
+					return fmt.Errorf("重定向次数过多（超过 %d 次）", maxRedirects)
+				}
+				return nil
 			},
 			Transport: &http.Transport{
-				Proxy: func(r *http.Request) (*pkgurl.URL, error) {
-					if op.Proxy != nil {
-						return op.Proxy, nil
-					}
-					return http.ProxyFromEnvironment(r)
-				},
-				DialContext: (&net.Dialer{
-					Resolver: op.Resolver,
-				}).DialContext,
-				DisableKeepAlives: true,
-				ForceAttemptHTTP2: false,
+				Proxy:               proxy,
+				DialContext:         transportDial,
+				TLSClientConfig:     op.TLSConfig,
+				DisableKeepAlives:   connPool == nil,
+				MaxIdleConns:        op.HTTPMaxIdleConns,
+				MaxIdleConnsPerHost: op.HTTPMaxIdleConns,
+				DisableCompression:  op.DisableCompression,
+				ForceAttemptHTTP2:   op.HTTP2 || offersH2(op),
 			},
 		},
 	}, nil
 }
 
+// offersH2 判断 ALPN 是否提供了 h2，提供时需要 Transport 支持 HTTP/2，否则协商成功后无法通信
+func offersH2(op *ping.Option) bool {
+	if op.TLSConfig == nil {
+		return false
+	}
+	for _, proto := range op.TLSConfig.NextProtos {
+		if proto == "h2" {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyFunc 返回请求使用的代理，指定的代理对所有目标（包括本机地址）生效，代理地址中的用户名和密码由 Transport 通过 Proxy-Authorization 发送，
+// 未指定代理时使用 HTTP_PROXY/HTTPS_PROXY 环境变量，两种情况下 NoProxy 中的地址都不使用代理
+func proxyFunc(op *ping.Option) func(*http.Request) (*pkgurl.URL, error) {
+	if op.Proxy == nil {
+		if op.NoEnvProxy {
+			return nil
+		}
+		config := httpproxy.FromEnvironment()
+		if len(op.NoProxy) > 0 {
+			config.NoProxy = strings.Join(op.NoProxy, ",")
+		}
+		proxy := config.ProxyFunc()
+		return func(r *http.Request) (*pkgurl.URL, error) {
+			return proxy(r.URL)
+		}
+	}
+	return func(r *http.Request) (*pkgurl.URL, error) {
+		if ping.BypassProxy(op.NoProxy, canonicalAddr(r.URL)) {
+			return nil, nil
+		}
+		return op.Proxy, nil
+	}
+}
+
+// canonicalAddr 返回 url 的 host:port，没有端口时使用协议的默认端口
+func canonicalAddr(u *pkgurl.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
 type Ping struct {
 	client *http.Client
+	proxy  func(*http.Request) (*pkgurl.URL, error)
 	trace  bool
 
 	option *ping.Option
 	method string
 
-	url string
+	url    string
+	target *pkgurl.URL
+
+	// dial 连接目标，Transport 和 --connect-only 共用
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	// pool 开启连接复用时统计连接池的使用情况，否则为空
+	pool *pool
 }
 
 func (p *Ping) Ping(ctx context.Context) *ping.Stats {
@@ -77,27 +189,124 @@ func (p *Ping) Ping(ctx context.Context) *ping.Stats {
 	if p.trace {
 		stats.Extra = &trace
 	}
+	if host := p.target.Hostname(); p.option.DNSSEC && net.ParseIP(host) == nil {
+		if result, err := p.option.CheckDNSSEC(ctx, host); err != nil {
+			stats.Meta["dnssec_error"] = String(ping.FormatError(err))
+		} else {
+			stats.Meta["dnssec_ad"] = String(strconv.FormatBool(result.AD))
+			stats.Meta["dnssec_signed"] = String(strconv.FormatBool(result.Signed))
+		}
+	}
 	start := time.Now()
-	req, err := http.NewRequestWithContext(trace.WithTrace(ctx), p.method, p.url, nil)
+	var body io.Reader
+	if len(p.option.Body) > 0 {
+		// 每次探测重新读取缓存的请求体
+		body = bytes.NewReader(p.option.Body)
+		stats.Meta["request_size"] = Int(len(p.option.Body))
+	}
+	var redirects, dnsAttempts int
+	ctx = context.WithValue(ctx, redirectsKey{}, &redirects)
+	ctx = context.WithValue(ctx, dnsAttemptsKey{}, &dnsAttempts)
+	ctx = ping.WithDebugTrace(ctx, p.option, p.url)
+	ctx, dnsServer := ping.WithDNSServer(ctx)
+	defer func() {
+		if dnsAttempts > 0 {
+			stats.Meta["dns_attempts"] = Int(dnsAttempts)
+		}
+		if server := dnsServer(); server != "" {
+			stats.Meta["dns_server"] = String(server)
+		}
+	}()
+	req, err := http.NewRequestWithContext(trace.WithTrace(ctx), p.method, p.url, body)
 	if err != nil {
 		stats.Error = err
 		return &stats
 	}
+	if body != nil {
+		contentType := p.option.ContentType
+		if contentType == "" {
+			contentType = "application/x-www-form-urlencoded"
+		}
+		req.Header.Set("content-type", contentType)
+	}
 	req.Header.Set("user-agent", p.option.UA)
+	for key, value := range p.option.Headers {
+		req.Header.Set(key, value)
+	}
+	if p.option.DisableCompression {
+		// 不自动解压时仍然请求压缩内容，字节数按实际传输的数据统计
+		req.Header.Set("accept-encoding", "gzip, deflate")
+	}
+	if p.option.Interface != "" {
+		stats.Meta["interface"] = String(p.option.Interface)
+	}
+	if p.option.DSCP != 0 {
+		stats.Meta["dscp"] = Int(p.option.DSCP)
+	}
+	if config := p.option.TLSConfig; req.URL.Scheme == "https" && config != nil {
+		if config.RootCAs != nil {
+			stats.Meta["custom_roots"] = String("true")
+		}
+		if config.ServerName != "" {
+			stats.Meta["sni"] = String(config.ServerName)
+		}
+	}
+	if p.proxy != nil {
+		if proxyURL, err := p.proxy(req); err == nil && proxyURL != nil {
+			stats.Meta["proxy"] = String(proxyURL.Redacted())
+		}
+	}
+	if p.option.ConnectOnly {
+		p.connect(req.Context(), &stats, &trace)
+		stats.Duration = time.Since(start)
+		return &stats
+	}
 	resp, err := p.client.Do(req)
 	stats.DNSDuration = trace.DNSDuration
 	stats.Address = trace.address
 
+	if p.option.FollowRedirects {
+		stats.Meta["redirects"] = Int(redirects)
+	}
+
 	if err != nil {
 		stats.Error = err
+		if trace.tlsErr != nil {
+			// 按握手的原始错误归类，例如对 http 服务使用 https 时的 tls.RecordHeaderError
+			stats.ErrorCode = ping.ClassifyError(trace.tlsErr)
+		}
 		stats.Duration = time.Since(start)
 	} else {
+		stats.Responded = true
 		stats.Meta["status"] = Int(resp.StatusCode)
+		if resp.TLS != nil {
+			p.tlsMeta(&stats, resp.TLS)
+		}
+		if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+			stats.Meta["content_encoding"] = String(encoding)
+		} else if resp.Uncompressed {
+			stats.Meta["content_encoding"] = String("gzip")
+		}
+		if location := resp.Header.Get("Location"); location != "" && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+			stats.Meta["location"] = String(location)
+		}
+		if p.option.DetectCaptive {
+			stats.Meta["captive"] = String(strconv.FormatBool(isCaptive(req, resp)))
+		}
+		for _, header := range p.option.HeaderOut {
+			// 缺少的响应头也输出空值，保持每行的列一致
+			stats.Meta[strings.ToLower(header)] = String(resp.Header.Get(header))
+		}
 		stats.Connected = true
+		if p.pool != nil {
+			stats.Meta["conn_reused"] = String(strconv.FormatBool(trace.reused))
+			p.pool.gotConn(trace.reused)
+		}
 		bodyStart := time.Now()
 		defer resp.Body.Close()
 		n, err := io.Copy(io.Discard, resp.Body)
 		trace.BodyDuration = time.Since(bodyStart)
+		stats.Bytes = n
 		if n > 0 {
 			stats.Meta["bytes"] = Int(n)
 		}
@@ -110,6 +319,45 @@ func (p *Ping) Ping(ctx context.Context) *ping.Stats {
 	return &stats
 }
 
+// Summary 开启连接复用时报告连接池的使用情况
+func (p *Ping) Summary() string {
+	if p.pool == nil {
+		return ""
+	}
+	return p.pool.String()
+}
+
+// Close 关闭连接池中的空闲连接
+func (p *Ping) Close() error {
+	if transport, ok := p.client.Transport.(*http.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+// isCaptive 判断响应是否来自强制门户（酒店、机场等需要登录的网络），连通性检查地址应当直接返回 204，
+// 被重定向到其他主机或者返回了其他内容（通常是登录页面）都认为遇到了强制门户
+func isCaptive(req *http.Request, resp *http.Response) bool {
+	if resp.Request != nil && resp.Request.URL.Host != req.URL.Host {
+		return true
+	}
+	return resp.StatusCode != http.StatusNoContent
+}
+
+// alpnResult 返回协商的 ALPN 协议，服务器没有选择任何协议时返回 none
+func alpnResult(proto string) string {
+	if proto == "" {
+		return "none"
+	}
+	return proto
+}
+
+type String string
+
+func (s String) String() string {
+	return string(s)
+}
+
 type Int int
 
 func (i Int) String() string {
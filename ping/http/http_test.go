@@ -2,14 +2,29 @@ package http_test
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	tcping "github.com/cloverstd/tcping/ping"
 	"github.com/cloverstd/tcping/ping/http"
 )
 
+func okHandler(w nethttp.ResponseWriter, r *nethttp.Request) {
+	_, _ = io.WriteString(w, "ok\n")
+}
+
 func TestPing(t *testing.T) {
-	ping, err := http.New("GET", "https://ssodr.iwhalecloud.com:40083/login/", &tcping.Option{}, false)
+	server := httptest.NewServer(nethttp.HandlerFunc(okHandler))
+	defer server.Close()
+
+	ping, err := http.New("GET", server.URL+"/login/", &tcping.Option{}, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -22,10 +37,21 @@ func TestPing(t *testing.T) {
 	if !stats.Connected {
 		t.Fatal(stats.Error)
 	}
+	if status := stats.Meta["status"].(http.Int); status != nethttp.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if stats.Bytes != 3 {
+		t.Fatalf("unexpected bytes %d", stats.Bytes)
+	}
 }
 
 func TestPingHTTPS(t *testing.T) {
-	ping, err := http.New("GET", "https://ssodr1.iwhalecloud.com:40083/login/", &tcping.Option{}, false)
+	server := httptest.NewTLSServer(nethttp.HandlerFunc(okHandler))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	ping, err := http.New("GET", server.URL+"/login/", &tcping.Option{TLSConfig: &tls.Config{RootCAs: pool}}, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -38,20 +64,221 @@ func TestPingHTTPS(t *testing.T) {
 	if !stats.Connected {
 		t.Fatal(stats.Error)
 	}
+
+	// 不信任自签名证书时探测失败
+	ping, err = http.New("GET", server.URL, &tcping.Option{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := ping.Ping(context.Background()); stats.Connected {
+		t.Fatal("it should fail to verify the certificate")
+	}
 }
 
-func TestPingRedirect(t *testing.T) {
-	ping, err := http.New("GET", "http://github.com", &tcping.Option{}, false)
+func TestPingHTTPSToHTTP(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(okHandler))
+	defer server.Close()
+
+	ping, err := http.New("GET", strings.Replace(server.URL, "http://", "https://", 1), &tcping.Option{}, false)
 	if err != nil {
 		t.Fatal(err)
 	}
+	// net/http 只以文字报告这个错误，按握手的原始错误归类
+	if stats := ping.Ping(context.Background()); stats.Connected || stats.ErrorCode != tcping.ErrTLS {
+		t.Fatalf("unexpected error %v, code %v", stats.Error, stats.ErrorCode)
+	}
+}
 
+func TestPingRedirect(t *testing.T) {
+	mux := nethttp.NewServeMux()
+	mux.HandleFunc("/", func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		nethttp.Redirect(w, r, "/next", nethttp.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/next", okHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ping, err := http.New("GET", server.URL, &tcping.Option{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
 	stats := ping.Ping(context.Background())
 	if !stats.Connected {
 		t.Fatal(stats.Error)
 	}
-	status := stats.Meta["status"].(http.Int)
-	if status != 301 {
+	if status := stats.Meta["status"].(http.Int); status != nethttp.StatusMovedPermanently {
 		t.Fatal("it should not be redirect")
 	}
+	if location := stats.Meta["location"]; location == nil || location.String() != "/next" {
+		t.Fatalf("unexpected location %v", location)
+	}
+
+	ping, err = http.New("GET", server.URL, &tcping.Option{FollowRedirects: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatal(stats.Error)
+	}
+	if status := stats.Meta["status"].(http.Int); status != nethttp.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if redirects := stats.Meta["redirects"].(http.Int); redirects != 1 {
+		t.Fatalf("unexpected redirects %d", redirects)
+	}
+}
+
+func TestPingCaptive(t *testing.T) {
+	check := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.WriteHeader(nethttp.StatusNoContent)
+	}))
+	defer check.Close()
+	portal := httptest.NewServer(nethttp.HandlerFunc(okHandler))
+	defer portal.Close()
+	// 强制门户把请求重定向到登录页面所在的主机
+	hijacked := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		nethttp.Redirect(w, r, portal.URL+"/login", nethttp.StatusFound)
+	}))
+	defer hijacked.Close()
+
+	for url, captive := range map[string]string{check.URL: "false", hijacked.URL: "true"} {
+		ping, err := http.New("GET", url, &tcping.Option{DetectCaptive: true, FollowRedirects: true}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats := ping.Ping(context.Background())
+		if !stats.Connected {
+			t.Fatal(stats.Error)
+		}
+		if got := stats.Meta["captive"]; got == nil || got.String() != captive {
+			t.Fatalf("%s: unexpected captive %v", url, got)
+		}
+	}
+}
+
+func TestPingALPN(t *testing.T) {
+	server := httptest.NewUnstartedServer(nethttp.HandlerFunc(okHandler))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	op := &tcping.Option{TLSConfig: &tls.Config{RootCAs: pool, NextProtos: []string{"h2"}}}
+	ping, err := http.New("GET", server.URL, op, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatal(stats.Error)
+	}
+	if got := stats.Meta["alpn"]; got == nil || got.String() != "h2" {
+		t.Fatalf("unexpected alpn %v", got)
+	}
+}
+
+func TestPingConnectOnly(t *testing.T) {
+	requested := false
+	server := httptest.NewTLSServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		requested = true
+	}))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	op := &tcping.Option{ConnectOnly: true, TLSConfig: &tls.Config{RootCAs: pool}}
+	ping, err := http.New("GET", server.URL, op, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatal(stats.Error)
+	}
+	if _, ok := stats.Meta["status"]; ok {
+		t.Fatal("it should not send the request")
+	}
+	if got := stats.Meta["tls_version"]; got == nil || got.String() != "TLS1.3" {
+		t.Fatalf("unexpected tls_version %v", got)
+	}
+	for _, key := range []string{"connect", "tls"} {
+		// 时间以 time.Duration 记录，--raw-duration 才能生效
+		if _, ok := stats.Meta[key].(time.Duration); !ok {
+			t.Fatalf("%s should be a duration, got %T", key, stats.Meta[key])
+		}
+	}
+	if requested {
+		t.Fatal("the server should not receive a request")
+	}
+	if stats.Responded {
+		t.Fatal("connect-only probes should not count as requests")
+	}
+}
+
+func TestPingMaxIdleConns(t *testing.T) {
+	server := httptest.NewServer(nethttp.HandlerFunc(okHandler))
+	defer server.Close()
+
+	ping, err := http.New("GET", server.URL, &tcping.Option{HTTPMaxIdleConns: 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ping.Close()
+	for i, reused := range []string{"false", "true"} {
+		stats := ping.Ping(context.Background())
+		if !stats.Connected {
+			t.Fatal(stats.Error)
+		}
+		if got := stats.Meta["conn_reused"]; got == nil || got.String() != reused {
+			t.Fatalf("probe %d: unexpected conn_reused %v", i, got)
+		}
+		if stats.Address != "127.0.0.1" {
+			t.Fatalf("probe %d: unexpected address %q", i, stats.Address)
+		}
+	}
+	if summary := ping.Summary(); !strings.Contains(summary, "1 opened, 1 reused, 1 idle (max idle 1)") {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+}
+
+func TestPingProxy(t *testing.T) {
+	target := httptest.NewServer(nethttp.HandlerFunc(okHandler))
+	defer target.Close()
+	proxied := make(chan string, 2)
+	proxy := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		proxied <- r.URL.String()
+		w.WriteHeader(nethttp.StatusNoContent)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	// 指定的代理对本机地址同样生效
+	ping, err := http.New("GET", target.URL, &tcping.Option{Proxy: proxyURL}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatal(stats.Error)
+	}
+	if status := stats.Meta["status"].(http.Int); status != nethttp.StatusNoContent {
+		t.Fatalf("it should go through the proxy, status %d", status)
+	}
+	if got := <-proxied; got != target.URL+"/" && got != target.URL {
+		t.Fatalf("unexpected proxied url %s", got)
+	}
+
+	ping, err = http.New("GET", target.URL, &tcping.Option{Proxy: proxyURL, NoProxy: []string{"127.0.0.1"}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatal(stats.Error)
+	}
+	if status := stats.Meta["status"].(http.Int); status != nethttp.StatusOK {
+		t.Fatalf("it should bypass the proxy, status %d", status)
+	}
 }
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// pool 统计开启连接复用（--http-max-idle-conns）时连接池的使用情况，Summary 可能在探测循环之外的协程中调用，
+// 探测依次执行，探测之间打开的连接都在连接池中空闲
+type pool struct {
+	maxIdle int
+	opened  int64 // 新建的连接数
+	open    int64 // 当前打开的连接数
+	reused  int64 // 复用空闲连接的请求数
+}
+
+// wrap 返回记录连接建立和关闭的 dial
+func (p *pool) wrap(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&p.opened, 1)
+		atomic.AddInt64(&p.open, 1)
+		return &poolConn{Conn: conn, pool: p}, nil
+	}
+}
+
+// gotConn 在请求拿到连接时调用，记录是否复用了空闲连接
+func (p *pool) gotConn(reused bool) {
+	if reused {
+		atomic.AddInt64(&p.reused, 1)
+	}
+}
+
+func (p *pool) String() string {
+	return fmt.Sprintf("HTTP connection pool:\n\t%d opened, %d reused, %d idle (max idle %d).",
+		atomic.LoadInt64(&p.opened), atomic.LoadInt64(&p.reused), atomic.LoadInt64(&p.open), p.maxIdle)
+}
+
+// poolConn 关闭时减少连接池中打开的连接数
+type poolConn struct {
+	net.Conn
+	pool *pool
+	once sync.Once
+}
+
+func (c *poolConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.pool.open, -1)
+	})
+	return c.Conn.Close()
+}
@@ -29,8 +29,12 @@ type Trace struct {
 	BodyDuration time.Duration `json:"body_duration"`
 
 	tlsState tls.ConnectionState
+	// tlsErr TLS 握手的原始错误，net/http 会把部分握手错误替换为只有文字的错误
+	tlsErr error
 
 	address string
+	// reused 请求使用了连接池中的空闲连接
+	reused bool
 }
 
 func (t *Trace) String() string {
@@ -71,6 +75,13 @@ func (t *Trace) WithTrace(ctx context.Context) context.Context {
 		ConnectDone: func(network, addr string, err error) {
 			t.ConnectDuration = time.Since(t.connectStart)
 		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.reused = info.Reused
+			if t.address == "" && info.Conn != nil {
+				// 复用的连接不会触发 ConnectStart
+				t.address, _, _ = net.SplitHostPort(info.Conn.RemoteAddr().String())
+			}
+		},
 		TLSHandshakeStart: func() {
 			t.tlsStart = time.Now()
 			t.tls = true
@@ -78,6 +89,7 @@ func (t *Trace) WithTrace(ctx context.Context) context.Context {
 		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
 			t.TLSDuration = time.Since(t.tlsStart)
 			t.tlsState = state
+			t.tlsErr = err
 		},
 		WroteRequest: func(info httptrace.WroteRequestInfo) {
 			t.WroteRequestDuration = time.Since(start) - t.TLSDuration - t.ConnectDuration - t.DNSDuration
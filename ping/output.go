@@ -0,0 +1,229 @@
+package ping
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// Outputter 接收每次探测的结果和最终的统计信息，可以替换默认的文本输出
+type Outputter interface {
+	OnStats(stats *Stats)
+	OnSummary(result Result)
+}
+
+// textOutput 默认的文本输出，每次一次性写入以免与其他目标的输出交错
+type textOutput struct {
+	pinger *Pinger
+	out    io.Writer
+}
+
+func (o *textOutput) OnStats(stats *Stats) {
+	if o.pinger.LineTemplate != nil {
+		if line, err := o.pinger.templateLine(stats); err == nil {
+			o.write(line)
+			return
+		}
+	}
+	o.write(o.pinger.statsText(stats))
+}
+
+// lineData LineTemplate 可以使用的字段
+type lineData struct {
+	Target      string
+	Seq         int // 第几次探测，从 1 开始
+	Address     string
+	Connected   bool
+	Duration    time.Duration
+	DNSDuration time.Duration
+	Error       string
+	Warning     string
+	Meta        map[string]string
+}
+
+// templateLine 使用 LineTemplate 格式化一次探测的结果，模板的输出没有以换行结尾时补上换行
+func (p *Pinger) templateLine(stats *Stats) (string, error) {
+	data := lineData{
+		Target:      p.url.String(),
+		Seq:         p.sent,
+		Address:     stats.Address,
+		Connected:   stats.Connected,
+		Duration:    stats.Duration,
+		DNSDuration: stats.DNSDuration,
+		Warning:     stats.Warning,
+		Meta:        make(map[string]string, len(stats.Meta)),
+	}
+	if stats.Error != nil {
+		data.Error = FormatError(stats.Error)
+	}
+	for key, value := range stats.Meta {
+		data.Meta[key] = value.String()
+	}
+	var buf strings.Builder
+	if err := p.LineTemplate.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	line := buf.String()
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	return line, nil
+}
+
+// OnSummary 文本输出包含抖动、失败原因等 Result 之外的信息，直接使用 Pinger 的统计数据
+func (o *textOutput) OnSummary(result Result) {
+	o.write(o.pinger.SummaryString())
+}
+
+func (o *textOutput) write(text string) {
+	if o.pinger.Label != "" {
+		text = labelLines(text, o.pinger.Label)
+	}
+	_, _ = io.WriteString(o.out, text)
+}
+
+// labelLines 在每个非空行前加上 [label]，空行保持不变
+func labelLines(text, label string) string {
+	var buf strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			buf.WriteString("[" + label + "] ")
+		}
+		buf.WriteString(line)
+	}
+	return buf.String()
+}
+
+// NewJSONOutput 创建 JSON 输出，每次探测输出一行 JSON（ndjson），结束时输出统计信息对象，
+// pretty 为 true 时统计信息缩进输出，每次探测的结果仍然保持一行便于流式处理，
+// 每条记录带有毫秒精度的 ISO8601 时间戳，使用 loc 指定的时区，为空时使用本地时区
+func NewJSONOutput(out io.Writer, target string, pretty bool, loc *time.Location) Outputter {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &jsonOutput{out: out, target: target, pretty: pretty, loc: loc}
+}
+
+type jsonOutput struct {
+	out    io.Writer
+	target string
+	pretty bool
+	loc    *time.Location
+}
+
+// jsonTimeFormat 毫秒精度的 ISO8601 时间格式
+const jsonTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// timestamp 返回记录的时间戳，在输出时（即探测完成时）计算
+func (o *jsonOutput) timestamp() string {
+	return time.Now().In(o.loc).Format(jsonTimeFormat)
+}
+
+type jsonStats struct {
+	Type        string            `json:"type"`
+	Timestamp   string            `json:"timestamp"`
+	Target      string            `json:"target"`
+	Connected   bool              `json:"connected"`
+	Address     string            `json:"address"`
+	Duration    time.Duration     `json:"duration"`
+	DNSDuration time.Duration     `json:"dns_duration"`
+	Bytes       int64             `json:"bytes"`
+	Error       string            `json:"error,omitempty"`
+	ErrorCode   ErrorCode         `json:"error_code"`
+	Meta        map[string]string `json:"meta,omitempty"`
+	Extra       string            `json:"extra,omitempty"`
+	Warning     string            `json:"warning,omitempty"`
+}
+
+type jsonSummary struct {
+	Type      string        `json:"type"`
+	Timestamp string        `json:"timestamp"`
+	Target    string        `json:"target"`
+	Counter   int           `json:"counter"`
+	Success   int           `json:"success"`
+	Failed    int           `json:"failed"`
+	Min       time.Duration `json:"min"`
+	Max       time.Duration `json:"max"`
+	Avg       time.Duration `json:"avg"`
+	Weight    float64       `json:"weight,omitempty"`
+
+	Jitter  time.Duration `json:"jitter"`
+	Stddev  time.Duration `json:"stddev"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+	LossPct float64       `json:"loss_pct"`
+
+	Warnings int `json:"warnings,omitempty"`
+}
+
+func (o *jsonOutput) OnStats(stats *Stats) {
+	v := jsonStats{
+		Type:        "probe",
+		Timestamp:   o.timestamp(),
+		Target:      o.target,
+		Connected:   stats.Connected,
+		Address:     stats.Address,
+		Duration:    stats.Duration,
+		DNSDuration: stats.DNSDuration,
+		Bytes:       stats.Bytes,
+		ErrorCode:   stats.ErrorCode,
+		Warning:     stats.Warning,
+	}
+	if stats.Error != nil {
+		v.Error = FormatError(stats.Error)
+	}
+	if len(stats.Meta) > 0 {
+		v.Meta = make(map[string]string, len(stats.Meta))
+		for key, value := range stats.Meta {
+			v.Meta[key] = value.String()
+		}
+	}
+	if stats.Extra != nil {
+		v.Extra = strings.TrimSpace(stats.Extra.String())
+	}
+	o.write(v, false)
+}
+
+func (o *jsonOutput) OnSummary(result Result) {
+	v := jsonSummary{
+		Type:      "summary",
+		Timestamp: o.timestamp(),
+		Target:    o.target,
+		Counter:   result.Counter,
+		Success:   result.SuccessCounter,
+		Failed:    result.Failed(),
+		Min:       result.MinDuration,
+		Max:       result.MaxDuration,
+		Avg:       result.Avg(),
+
+		Jitter:  result.Jitter,
+		Stddev:  result.Stddev,
+		P50:     result.P50,
+		P90:     result.P90,
+		P99:     result.P99,
+		LossPct: result.LossPct,
+
+		Warnings: result.Warnings,
+	}
+	if result.Target != nil {
+		v.Weight = result.Target.Weight
+	}
+	o.write(v, o.pretty)
+}
+
+// write 编码后一次性写入，以免与其他目标的输出交错
+func (o *jsonOutput) write(v interface{}, indent bool) {
+	var data []byte
+	var err error
+	if indent {
+		data, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return
+	}
+	_, _ = o.out.Write(append(data, '\n'))
+}
@@ -3,9 +3,13 @@ package ping_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"text/template"
 	"time"
 
 	tcping "github.com/cloverstd/tcping/ping"
@@ -23,6 +27,53 @@ func (s String) String() string {
 	return string(s)
 }
 
+// fakeClock 计时器立即触发并把当前时间前移计时的时长，探测循环不需要真实等待
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) tcping.Timer {
+	timer := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	timer.Reset(d)
+	return timer
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	c     chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	t.clock.now = t.clock.now.Add(d)
+	now := t.clock.now
+	t.clock.mu.Unlock()
+	select {
+	case t.c <- now:
+	default:
+	}
+	return true
+}
+
+func (t *fakeTimer) Stop() bool {
+	select {
+	case <-t.c:
+	default:
+	}
+	return true
+}
+
 func TestPinger(t *testing.T) {
 	u, _ := url.Parse("https://hui.lu")
 	var buf bytes.Buffer
@@ -40,7 +91,500 @@ func TestPinger(t *testing.T) {
 				Extra: String("tls: 1.3"),
 			}
 		}), time.Second, 2)
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	pinger.Clock = clock
 	pinger.Ping()
+	// 第一次探测立即执行，之后每次探测后都重新计时一个间隔
+	if elapsed := clock.Now().Sub(time.Unix(0, 0)); elapsed != 2*time.Second+1 {
+		t.Fatalf("unexpected elapsed time %s", elapsed)
+	}
 	pinger.Summarize()
 	fmt.Println(buf.String())
 }
+
+func TestPinger_StartDelay(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	var first time.Time
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	pinger := tcping.NewPinger(nil, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			if first.IsZero() {
+				first = clock.Now()
+			}
+			return &tcping.Stats{Connected: true, Duration: time.Millisecond}
+		}), time.Second, 2)
+	pinger.Output = &memoryOutput{}
+	pinger.Clock = clock
+	pinger.StartDelay = 30 * time.Millisecond
+	pinger.Ping()
+	if elapsed := first.Sub(time.Unix(0, 0)); elapsed != 30*time.Millisecond+1 {
+		t.Fatalf("unexpected first probe at %s", elapsed)
+	}
+}
+
+func TestPinger_StuckProbe(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	var buf bytes.Buffer
+	pinger := tcping.NewPinger(&buf, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			// 忽略 ctx，模拟卡住的执行器
+			time.Sleep(time.Second)
+			return &tcping.Stats{Connected: true}
+		}), time.Millisecond*10, 1)
+	pinger.Timeout = time.Millisecond * 50
+	pinger.Ping()
+	pinger.Summarize()
+	if !strings.Contains(buf.String(), "timeout = 1") {
+		t.Fatalf("stuck probe should be recorded as timeout, got %s", buf.String())
+	}
+}
+
+func TestPinger_HTTPRequests(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1:80")
+	var buf bytes.Buffer
+	probes := 0
+	pinger := tcping.NewPinger(&buf, u, PingHandler(func(ctx context.Context) *tcping.Stats {
+		// 只有第一次探测收到了响应，其余探测只建立连接
+		probes++
+		stats := &tcping.Stats{Connected: true, Responded: probes == 1}
+		if stats.Responded {
+			stats.Bytes = 3
+		}
+		return stats
+	}), time.Millisecond, 3)
+	pinger.Ping()
+	pinger.Summarize()
+	if !strings.Contains(buf.String(), "1 requests, 3 bytes downloaded.") {
+		t.Fatalf("unexpected summary %s", buf.String())
+	}
+}
+
+// budgetHandler 连接超时长于 Timeout 的执行器
+type budgetHandler struct {
+	PingHandler
+	budget time.Duration
+}
+
+func (h budgetHandler) Budget() time.Duration {
+	return h.budget
+}
+
+func TestPinger_ProbeBudget(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	var buf bytes.Buffer
+	pinger := tcping.NewPinger(&buf, u, budgetHandler{
+		PingHandler: func(ctx context.Context) *tcping.Stats {
+			// 慢于 Timeout，但在执行器自己的上限之内
+			select {
+			case <-time.After(time.Millisecond * 200):
+				return &tcping.Stats{Connected: true}
+			case <-ctx.Done():
+				return &tcping.Stats{Error: ctx.Err()}
+			}
+		},
+		budget: time.Second,
+	}, time.Millisecond*10, 1)
+	pinger.Timeout = time.Millisecond * 50
+	pinger.Ping()
+	if result := pinger.Statistics(); result.SuccessCounter != 1 {
+		t.Fatalf("slow probe within the budget should succeed, got %+v", result)
+	}
+}
+
+// memoryOutput 在内存中记录输出，便于断言
+type memoryOutput struct {
+	stats   []*tcping.Stats
+	results []tcping.Result
+}
+
+func (o *memoryOutput) OnStats(stats *tcping.Stats) {
+	o.stats = append(o.stats, stats)
+}
+
+func (o *memoryOutput) OnSummary(result tcping.Result) {
+	o.results = append(o.results, result)
+}
+
+func TestPinger_Output(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	pinger := tcping.NewPinger(nil, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			return &tcping.Stats{Connected: true, Duration: time.Millisecond}
+		}), time.Millisecond, 3)
+	output := &memoryOutput{}
+	pinger.Output = output
+	pinger.Ping()
+	pinger.Summarize()
+	if len(output.stats) != 3 || len(output.results) != 1 {
+		t.Fatalf("unexpected output %d stats, %d results", len(output.stats), len(output.results))
+	}
+	if result := output.results[0]; result.Counter != 3 || result.SuccessCounter != 3 || result.Avg() != time.Millisecond {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestPinger_StopOnDown(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	probes := 0
+	pinger := tcping.NewPinger(nil, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			// 前两次成功，之后一直失败
+			if probes++; probes <= 2 {
+				return &tcping.Stats{Connected: true}
+			}
+			return &tcping.Stats{Error: fmt.Errorf("refused")}
+		}), time.Millisecond, 0)
+	pinger.Output = &memoryOutput{}
+	pinger.StopOnDown = 3
+	pinger.Ping()
+	if !pinger.Down() || probes != 5 {
+		t.Fatalf("it should stop after 3 consecutive failures, got %d probes", probes)
+	}
+}
+
+func TestPinger_AllFailed(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:1")
+	var buf bytes.Buffer
+	pinger := tcping.NewPinger(&buf, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			return &tcping.Stats{Error: fmt.Errorf("refused"), Duration: time.Millisecond}
+		}), time.Millisecond, 3)
+	pinger.Ping()
+	pinger.Summarize()
+	summary := buf.String()
+	if !strings.Contains(summary, "All 3 probes failed; target unreachable.") {
+		t.Fatalf("unexpected summary %s", summary)
+	}
+	if strings.Contains(summary, "Minimum") {
+		t.Fatalf("all failed summary should not contain trip times, got %s", summary)
+	}
+	if result := pinger.Statistics(); result.MinDuration != 0 || result.Avg() != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestPinger_Deadline(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	pinger := tcping.NewPinger(nil, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			return &tcping.Stats{Connected: true}
+		}), time.Millisecond, 0)
+	pinger.Output = &memoryOutput{}
+	pinger.Deadline = 20 * time.Millisecond
+	done := make(chan struct{})
+	go func() {
+		pinger.Ping()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pinger should stop at the deadline")
+	}
+	if result := pinger.Statistics(); result.Counter == 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestPinger_UniqueErrors(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:1")
+	var buf bytes.Buffer
+	var n int
+	pinger := tcping.NewPinger(&buf, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			n++
+			if n == 1 {
+				return &tcping.Stats{Error: fmt.Errorf("reset")}
+			}
+			return &tcping.Stats{Error: fmt.Errorf("refused")}
+		}), time.Millisecond, 3)
+	pinger.Ping()
+	pinger.Summarize()
+	if summary := buf.String(); !strings.Contains(summary, "Errors:\n\t2 x refused\n\t1 x reset\n") {
+		t.Fatalf("unexpected summary %s", summary)
+	}
+}
+
+func TestPinger_SummaryString(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	var buf bytes.Buffer
+	durations := []time.Duration{time.Millisecond, 3 * time.Millisecond}
+	pinger := tcping.NewPinger(&buf, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			d := durations[0]
+			durations = durations[1:]
+			return &tcping.Stats{Connected: true, Duration: d}
+		}), time.Millisecond, 2)
+	pinger.Ping()
+	buf.Reset()
+	summary := pinger.SummaryString()
+	if buf.Len() != 0 {
+		t.Fatalf("SummaryString should not write, got %s", buf.String())
+	}
+	for _, s := range []string{"2 probes sent.", "Packet loss = 0.0%", "Minimum = 1ms, Maximum = 3ms, Average = 2ms"} {
+		if !strings.Contains(summary, s) {
+			t.Fatalf("summary should contain %q, got %s", s, summary)
+		}
+	}
+	result := pinger.Statistics()
+	if result.Stddev != time.Millisecond || result.P50 != time.Millisecond || result.P99 != 3*time.Millisecond || result.LossPct != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	var buf bytes.Buffer
+	pinger := tcping.NewPinger(nil, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			return &tcping.Stats{Connected: true, Duration: time.Millisecond}
+		}), time.Millisecond, 2)
+	pinger.Output = tcping.NewJSONOutput(&buf, u.String(), true, time.UTC)
+	pinger.Ping()
+	pinger.Summarize()
+	lines := strings.SplitN(buf.String(), "\n", 3)
+	for _, line := range lines[:2] {
+		if !strings.HasPrefix(line, `{"type":"probe","timestamp":"`) {
+			t.Fatalf("probe should be one line, got %s", line)
+		}
+		var v struct{ Timestamp string }
+		if err := json.Unmarshal([]byte(line), &v); err != nil || !strings.HasSuffix(v.Timestamp, "Z") || len(v.Timestamp) != len("2006-01-02T15:04:05.000Z") {
+			t.Fatalf("unexpected timestamp %q, %v", v.Timestamp, err)
+		}
+	}
+	if !strings.HasPrefix(lines[2], "{\n  \"type\": \"summary\"") {
+		t.Fatalf("summary should be indented, got %s", lines[2])
+	}
+}
+
+func TestPinger_ByAddress(t *testing.T) {
+	u, _ := url.Parse("tcp://example.com:80")
+	var buf bytes.Buffer
+	addresses := []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.1:80"}
+	pinger := tcping.NewPinger(&buf, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			address := addresses[0]
+			addresses = addresses[1:]
+			return &tcping.Stats{Connected: true, Address: address, Duration: time.Millisecond}
+		}), time.Millisecond, 3)
+	pinger.Ping()
+	summary := pinger.SummaryString()
+	for _, s := range []string{"Trip times by address:", "10.0.0.1: 2 probes", "10.0.0.2: 1 probes"} {
+		if !strings.Contains(summary, s) {
+			t.Fatalf("summary should contain %q, got %s", s, summary)
+		}
+	}
+}
+
+func TestOption_Debugf(t *testing.T) {
+	var buf bytes.Buffer
+	op := tcping.Option{Verbose: 1, DebugOut: &buf}
+	op.Debugf(1, "dns done in %s", time.Millisecond)
+	op.Debugf(2, "dns start")
+	if got := buf.String(); !strings.HasSuffix(got, " debug: dns done in 1ms\n") || strings.Count(got, "\n") != 1 {
+		t.Fatalf("unexpected debug output %q", got)
+	}
+}
+
+func TestPinger_RunningStats(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	var buf bytes.Buffer
+	durations := []time.Duration{3 * time.Millisecond, time.Millisecond, 5 * time.Millisecond}
+	var i int
+	pinger := tcping.NewPinger(&buf, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			i++
+			return &tcping.Stats{Connected: true, Duration: durations[i-1]}
+		}), time.Second, len(durations))
+	pinger.Clock = &fakeClock{now: time.Unix(0, 0)}
+	pinger.RunningStats = true
+	pinger.Ping()
+	for _, expected := range []string{"[3ms/3ms/3ms]", "[1ms/2ms/3ms]", "[1ms/3ms/5ms]"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("missing %s in %s", expected, buf.String())
+		}
+	}
+}
+
+func TestPinger_Label(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	var buf bytes.Buffer
+	pinger := tcping.NewPinger(&buf, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			return &tcping.Stats{Connected: true, Duration: time.Millisecond}
+		}), time.Second, 1)
+	pinger.Clock = &fakeClock{now: time.Unix(0, 0)}
+	pinger.Label = "web1"
+	pinger.Ping()
+	pinger.Summarize()
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line != "" && !strings.HasPrefix(line, "[web1] ") {
+			t.Fatalf("line without label %q", line)
+		}
+	}
+}
+
+func TestPinger_CountByIP(t *testing.T) {
+	u, _ := url.Parse("tcp://example.com:80")
+	var buf bytes.Buffer
+	addresses := []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.1:80", "10.0.0.2:80"}
+	pinger := tcping.NewPinger(&buf, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			address := addresses[0]
+			addresses = addresses[1:]
+			if address == "10.0.0.2:80" && len(addresses) == 0 {
+				return &tcping.Stats{Address: address, Error: fmt.Errorf("refused")}
+			}
+			return &tcping.Stats{Connected: true, Address: address, Duration: time.Millisecond}
+		}), time.Second, 4)
+	pinger.Clock = &fakeClock{now: time.Unix(0, 0)}
+	pinger.CountByIP = true
+	pinger.Ping()
+	summary := pinger.SummaryString()
+	for _, s := range []string{"Probes by IP:", "10.0.0.1: 2 probes (50.0%), 2 successful (100.0%)", "10.0.0.2: 2 probes (50.0%), 1 successful (50.0%)"} {
+		if !strings.Contains(summary, s) {
+			t.Fatalf("summary should contain %q, got %s", s, summary)
+		}
+	}
+}
+
+func TestPinger_DrainOnStop(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	for _, drain := range []bool{false, true} {
+		started := make(chan struct{}, 1)
+		pinger := tcping.NewPinger(nil, u,
+			PingHandler(func(ctx context.Context) *tcping.Stats {
+				started <- struct{}{}
+				select {
+				case <-ctx.Done():
+					return &tcping.Stats{Error: ctx.Err()}
+				case <-time.After(50 * time.Millisecond):
+					return &tcping.Stats{Connected: true, Duration: 50 * time.Millisecond}
+				}
+			}), time.Second, 0)
+		pinger.Output = &memoryOutput{}
+		pinger.DrainOnStop = drain
+		go pinger.Ping()
+		<-started
+		pinger.Stop()
+		<-pinger.Finished()
+		// 不等待时进行中的探测被取消
+		if result := pinger.Statistics(); result.Counter != 1 || (result.SuccessCounter == 1) != drain {
+			t.Fatalf("drain=%t: unexpected result %+v", drain, result)
+		}
+	}
+}
+
+func TestPinger_ResetStatsOnUp(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	up := []bool{true, false, true, true}
+	pinger := tcping.NewPinger(nil, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			connected := up[0]
+			up = up[1:]
+			if !connected {
+				return &tcping.Stats{Error: fmt.Errorf("refused")}
+			}
+			return &tcping.Stats{Connected: true, Duration: time.Millisecond}
+		}), time.Second, 4)
+	output := &memoryOutput{}
+	pinger.Output = output
+	pinger.Clock = &fakeClock{now: time.Unix(0, 0)}
+	pinger.ResetStatsOnUp = true
+	pinger.Ping()
+	if len(output.stats) != 4 {
+		t.Fatalf("unexpected probes %d", len(output.stats))
+	}
+	// 恢复前的窗口包含一次成功和一次失败
+	if len(output.results) != 1 || output.results[0].Counter != 2 || output.results[0].Failed() != 1 {
+		t.Fatalf("unexpected window summaries %+v", output.results)
+	}
+	if result := pinger.Statistics(); result.Counter != 2 || result.Failed() != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestPinger_FailuresOnly(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	up := []bool{true, true, false, false, true, true}
+	pinger := tcping.NewPinger(nil, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			connected := up[0]
+			up = up[1:]
+			if !connected {
+				return &tcping.Stats{Error: fmt.Errorf("refused")}
+			}
+			return &tcping.Stats{Connected: true, Duration: time.Millisecond}
+		}), time.Second, 6)
+	output := &memoryOutput{}
+	pinger.Output = output
+	pinger.Clock = &fakeClock{now: time.Unix(0, 0)}
+	pinger.FailuresOnly = true
+	pinger.Ping()
+	// 第一次探测、两次失败和恢复的那次成功
+	if len(output.stats) != 4 {
+		t.Fatalf("unexpected probes %d", len(output.stats))
+	}
+	if result := pinger.Statistics(); result.Counter != 6 || result.Failed() != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestPinger_Progress(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	var progress bytes.Buffer
+	var i int
+	pinger := tcping.NewPinger(nil, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			if i++; i == 1 {
+				return &tcping.Stats{Error: fmt.Errorf("refused")}
+			}
+			return &tcping.Stats{Connected: true, Duration: time.Millisecond}
+		}), time.Second, 2)
+	pinger.Output = &memoryOutput{}
+	pinger.Clock = &fakeClock{now: time.Unix(0, 0)}
+	pinger.Progress = &progress
+	pinger.Ping()
+	for _, s := range []string{"[###############...............] 1/2, loss 100.0%", "[##############################] 2/2, loss 50.0%"} {
+		if !strings.Contains(progress.String(), s) {
+			t.Fatalf("progress should contain %q, got %q", s, progress.String())
+		}
+	}
+	// 结束时清除进度条
+	if !strings.HasSuffix(progress.String(), "\r\033[K") {
+		t.Fatalf("progress should be cleared, got %q", progress.String())
+	}
+}
+
+func TestPinger_LineTemplate(t *testing.T) {
+	u, _ := url.Parse("tcp://127.0.0.1:80")
+	var buf bytes.Buffer
+	pinger := tcping.NewPinger(&buf, u,
+		PingHandler(func(ctx context.Context) *tcping.Stats {
+			return &tcping.Stats{Connected: true, Address: "127.0.0.1:80", Duration: time.Millisecond,
+				Meta: map[string]fmt.Stringer{"status": String("200")}}
+		}), time.Second, 2)
+	pinger.Clock = &fakeClock{now: time.Unix(0, 0)}
+	pinger.LineTemplate = template.Must(template.New("line").Parse(`{{.Seq}} {{.Address}} {{.Duration}} {{.Meta.status}}`))
+	pinger.Ping()
+	if expected := "1 127.0.0.1:80 1ms 200\n2 127.0.0.1:80 1ms 200\n"; buf.String() != expected {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
+
+func TestCompareText(t *testing.T) {
+	results := []tcping.Result{
+		{Counter: 4, SuccessCounter: 4, TotalDuration: 40 * time.Millisecond, Target: &tcping.Target{Host: "a", Weight: 1}},
+		{Counter: 4, SuccessCounter: 2, TotalDuration: 20 * time.Millisecond, LossPct: 50, Target: &tcping.Target{Host: "b", Weight: 4}},
+		{Counter: 4, Target: &tcping.Target{Host: "c", Weight: 1}},
+	}
+	// a：10ms / 1 / 1，b：10ms / 0.5 / 4，c 没有成功的探测
+	if a, b := results[0].Score(), results[1].Score(); a != 10 || b != 5 {
+		t.Fatalf("unexpected scores %v %v", a, b)
+	}
+	text := tcping.CompareText(results)
+	b, a, c := strings.Index(text, "1. tcp://b"), strings.Index(text, "2. tcp://a"), strings.Index(text, "3. tcp://c")
+	if b < 0 || a < b || c < a || !strings.Contains(text, "score=n/a") {
+		t.Fatalf("unexpected comparison %q", text)
+	}
+}
@@ -0,0 +1,46 @@
+package ping
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// progressWidth 进度条的字符数
+const progressWidth = 30
+
+// renderProgress 返回进度条的文本，total 不大于 0（不限次数）时只显示完成的次数
+func renderProgress(done, total, sent, failed int) string {
+	loss := 0.0
+	if sent > 0 {
+		loss = float64(failed) / float64(sent) * 100
+	}
+	if total <= 0 {
+		return fmt.Sprintf("%d probes, loss %.1f%%", done, loss)
+	}
+	filled := done * progressWidth / total
+	if filled > progressWidth {
+		filled = progressWidth
+	}
+	return fmt.Sprintf("[%s%s] %d/%d, loss %.1f%%",
+		strings.Repeat("#", filled), strings.Repeat(".", progressWidth-filled), done, total, loss)
+}
+
+// drawProgress 在 Progress 的当前行绘制进度条，不换行
+func (p *Pinger) drawProgress() {
+	if p.Progress == nil {
+		return
+	}
+	p.mu.Lock()
+	line := renderProgress(p.sent, p.counter, p.total, p.failedTotal)
+	p.mu.Unlock()
+	_, _ = io.WriteString(p.Progress, "\r\033[K"+line)
+}
+
+// clearProgress 清除进度条所在的行，其他输出写入前调用，进度条始终在最后一行
+func (p *Pinger) clearProgress() {
+	if p.Progress == nil {
+		return
+	}
+	_, _ = io.WriteString(p.Progress, "\r\033[K")
+}
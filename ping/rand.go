@@ -0,0 +1,30 @@
+package ping
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 包内共用的随机数，默认以当前时间为种子，通过 Seed 固定种子后结果可以复现
+var (
+	rngMu sync.Mutex
+	rng   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Seed 设置随机数种子
+func Seed(seed int64) {
+	rngMu.Lock()
+	defer rngMu.Unlock()
+	rng = rand.New(rand.NewSource(seed))
+}
+
+// RandIntn 返回 [0, n) 之间的随机整数，n 不大于 0 时返回 0
+func RandIntn(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	rngMu.Lock()
+	defer rngMu.Unlock()
+	return rng.Intn(n)
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package ping
+
+import "golang.org/x/sys/windows"
+
+// errConnRefused 连接被拒绝时系统返回的错误码
+var errConnRefused error = windows.WSAECONNREFUSED
@@ -0,0 +1,35 @@
+package ping
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultReservoirSize 近似计算百分位时最多保留的往返时间样本数
+const DefaultReservoirSize = 4096
+
+// reservoir 按水塘抽样（Algorithm R）保留样本，样本数超过上限后每个值被保留的概率相同，
+// 长时间运行时内存占用固定，百分位是基于均匀样本的估计
+type reservoir struct {
+	seen    int
+	samples []time.Duration
+}
+
+// add 记录一个值，size 不大于 0 时保留全部的值
+func (r *reservoir) add(d time.Duration, size int) {
+	r.seen++
+	if size <= 0 || len(r.samples) < size {
+		r.samples = append(r.samples, d)
+		return
+	}
+	if i := RandIntn(r.seen); i < size {
+		r.samples[i] = d
+	}
+}
+
+// sorted 返回排序后的样本副本
+func (r *reservoir) sorted() []time.Duration {
+	sorted := append([]time.Duration{}, r.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
@@ -0,0 +1,32 @@
+package ping
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReservoir(t *testing.T) {
+
+	Convey("水塘抽样测试", t, func() {
+		Convey("for bounded size", func() {
+			var r reservoir
+			for i := 1; i <= 100000; i++ {
+				r.add(time.Duration(i), 1000)
+			}
+			So(len(r.samples), ShouldEqual, 1000)
+			So(r.seen, ShouldEqual, 100000)
+			// 均匀样本的中位数接近真实的中位数
+			So(float64(Percentile(r.sorted(), 50)), ShouldAlmostEqual, 50000, 5000)
+		})
+
+		Convey("for exact mode", func() {
+			var r reservoir
+			for i := 10; i > 0; i-- {
+				r.add(time.Duration(i), 0)
+			}
+			So(r.sorted(), ShouldResemble, []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+		})
+	})
+}
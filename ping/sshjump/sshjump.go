@@ -0,0 +1,125 @@
+package sshjump
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultKeys 未指定私钥时依次尝试的私钥文件
+var defaultKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// Dial 连接跳板机，jump 的格式为 [user@]host[:port]，认证方式依次为 keyFile 指定的私钥（未指定时使用 ~/.ssh 下的默认私钥）和 SSH_AUTH_SOCK 中的 agent，
+// 使用 ~/.ssh/known_hosts 校验跳板机的主机密钥
+func Dial(jump string, keyFile string, timeout time.Duration) (*ssh.Client, error) {
+	username, addr := parseJump(jump)
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("读取用户目录失败，%w", err)
+	}
+	hostKeyCallback, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("读取 known_hosts 失败，%w", err)
+	}
+
+	var methods []ssh.AuthMethod
+	if signers := loadKeys(home, keyFile); len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	} else if keyFile != "" {
+		return nil, fmt.Errorf("无法读取私钥 %s", keyFile)
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("没有可用的 SSH 认证方式（私钥或 agent）")
+	}
+
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            username,
+		Auth:            methods,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("连接跳板机 %s 失败，%w", addr, err)
+	}
+	return client, nil
+}
+
+// DialContext 返回通过跳板机连接目标的拨号函数，目标的域名由跳板机解析
+func DialContext(client *ssh.Client) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		type result struct {
+			conn net.Conn
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			// ssh 的 Dial 不支持 context，超时后在后台关闭迟到的连接
+			conn, err := client.Dial("tcp", addr)
+			done <- result{conn, err}
+		}()
+		select {
+		case r := <-done:
+			return r.conn, r.err
+		case <-ctx.Done():
+			go func() {
+				if r := <-done; r.conn != nil {
+					_ = r.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// parseJump 解析 [user@]host[:port]，未指定用户时使用当前用户，未指定端口时使用 22
+func parseJump(jump string) (username, addr string) {
+	addr = jump
+	if i := strings.LastIndex(jump, "@"); i >= 0 {
+		username, addr = jump[:i], jump[i+1:]
+	}
+	if username == "" {
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), "22")
+	}
+	return username, addr
+}
+
+// loadKeys 读取指定的私钥，未指定时读取 ~/.ssh 下存在的默认私钥，有密码保护的私钥需要通过 agent 使用
+func loadKeys(home, keyFile string) []ssh.Signer {
+	files := []string{keyFile}
+	if keyFile == "" {
+		files = files[:0]
+		for _, name := range defaultKeys {
+			files = append(files, filepath.Join(home, ".ssh", name))
+		}
+	}
+	var signers []ssh.Signer
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(data); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	return signers
+}
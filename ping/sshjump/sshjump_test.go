@@ -0,0 +1,24 @@
+package sshjump
+
+import (
+	"testing"
+)
+
+func TestParseJump(t *testing.T) {
+	cases := []struct {
+		jump, username, addr string
+	}{
+		{"ops@bastion", "ops", "bastion:22"},
+		{"ops@bastion:2222", "ops", "bastion:2222"},
+		{"ops@[fd00::1]", "ops", "[fd00::1]:22"},
+	}
+	for _, c := range cases {
+		username, addr := parseJump(c.jump)
+		if username != c.username || addr != c.addr {
+			t.Fatalf("parseJump(%q) = %q, %q", c.jump, username, addr)
+		}
+	}
+	if username, _ := parseJump("bastion"); username == "" {
+		t.Fatalf("it should default to the current user")
+	}
+}
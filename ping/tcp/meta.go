@@ -1,9 +1,12 @@
 package tcp
 
 import (
+	"crypto/x509"
 	"fmt"
 	"strings"
 	"time"
+
+	"golang.org/x/crypto/ocsp"
 )
 
 var _ fmt.Stringer = (*Meta)(nil)
@@ -14,17 +17,47 @@ type Meta struct {
 	serverName string
 	notBefore  time.Time
 	notAfter   time.Time
+
+	chainLength  int    // 服务器发送的证书数量
+	issuer       string // 叶子证书签发者的 CN
+	chainTrusted bool   // 证书链能否到达受信任的根证书，与证书是否过期、域名是否匹配无关
+
+	ocspStapled bool
+	ocspStatus  string // 装订的 OCSP 响应的状态：good、revoked、unknown 或 invalid（无法解析、签名错误或已过期）
 }
 
 func (m Meta) String() string {
-	return fmt.Sprintf(
-		"server_name=%s version=%d dns_names=%s (%s~%s)",
+	s := fmt.Sprintf(
+		"server_name=%s version=%d dns_names=%s (%s~%s) chain_length=%d issuer=%q chain_trusted=%t ocsp_stapled=%t",
 		m.serverName,
 		m.version,
 		strings.Join(m.dnsNames, ","),
 		formatTime(m.notBefore),
 		formatTime(m.notAfter),
+		m.chainLength,
+		m.issuer,
+		m.chainTrusted,
+		m.ocspStapled,
 	)
+	if m.ocspStapled {
+		s += " ocsp_status=" + m.ocspStatus
+	}
+	return s
+}
+
+// ocspStatus 解析服务器装订的 OCSP 响应，issuer 为空时无法验证签名
+func ocspStatus(raw []byte, leaf, issuer *x509.Certificate, now time.Time) string {
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil || (!resp.NextUpdate.IsZero() && now.After(resp.NextUpdate)) {
+		return "invalid"
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	}
+	return "unknown"
 }
 
 func formatTime(t time.Time) string {
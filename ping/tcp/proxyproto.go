@@ -0,0 +1,81 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/cloverstd/tcping/ping"
+)
+
+// proxyProtocolSignature PROXY protocol v2 头的固定前缀
+var proxyProtocolSignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyHeader 生成 PROXY protocol 头，源地址和目标地址的地址族不同时都按 IPv6 发送
+func proxyHeader(version string, src, dst *net.TCPAddr) ([]byte, error) {
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	ipv4 := srcIP != nil && dstIP != nil
+	if !ipv4 {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+	}
+	switch version {
+	case ping.ProxyProtocolV1:
+		family := "TCP4"
+		if !ipv4 {
+			family = "TCP6"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, v1Addr(srcIP), v1Addr(dstIP), src.Port, dst.Port)), nil
+	case ping.ProxyProtocolV2:
+		header := append([]byte{}, proxyProtocolSignature...)
+		// 版本 2，PROXY 命令
+		header = append(header, 0x21)
+		if ipv4 {
+			header = append(header, 0x11, 0, 12)
+		} else {
+			header = append(header, 0x21, 0, 36)
+		}
+		header = append(header, srcIP...)
+		header = append(header, dstIP...)
+		ports := make([]byte, 4)
+		binary.BigEndian.PutUint16(ports, uint16(src.Port))
+		binary.BigEndian.PutUint16(ports[2:], uint16(dst.Port))
+		return append(header, ports...), nil
+	}
+	return nil, fmt.Errorf("不支持的 PROXY protocol 版本 %s", version)
+}
+
+// v1Addr 文本格式中的地址，TCP6 中的 IPv4 地址按 IPv4 映射地址输出
+func v1Addr(ip net.IP) string {
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr.String()
+}
+
+// resolveProxyAddr 解析指定的 PROXY protocol 地址，未指定时使用 conn 的地址
+func resolveProxyAddr(addr string, conn net.Addr) (*net.TCPAddr, error) {
+	if addr == "" {
+		if tcpAddr, ok := conn.(*net.TCPAddr); ok {
+			return tcpAddr, nil
+		}
+		return nil, fmt.Errorf("无法获取连接的地址，请指定 PROXY protocol 的地址")
+	}
+	return net.ResolveTCPAddr("tcp", addr)
+}
+
+// writeProxyHeader 在连接建立后发送 PROXY protocol 头
+func (p *Ping) writeProxyHeader(conn net.Conn) error {
+	src, err := resolveProxyAddr(p.option.ProxyProtocolSrc, conn.LocalAddr())
+	if err != nil {
+		return err
+	}
+	dst, err := resolveProxyAddr(p.option.ProxyProtocolDst, conn.RemoteAddr())
+	if err != nil {
+		return err
+	}
+	header, err := proxyHeader(p.option.ProxyProtocol, src, dst)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(header)
+	return err
+}
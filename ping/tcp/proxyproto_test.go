@@ -0,0 +1,38 @@
+package tcp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestProxyHeader(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}
+
+	header, err := proxyHeader("v1", src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(header) != "PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\n" {
+		t.Fatalf("unexpected v1 header %q", header)
+	}
+
+	header, err = proxyHeader("v2", src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append([]byte("\r\n\r\n\x00\r\nQUIT\n"), 0x21, 0x11, 0, 12, 192, 168, 0, 1, 10, 0, 0, 1, 0xdc, 0x04, 0x01, 0xbb)
+	if !bytes.Equal(header, expected) {
+		t.Fatalf("unexpected v2 header %x", header)
+	}
+
+	// 地址族不同时按 IPv6 发送
+	header, err = proxyHeader("v1", src, &net.TCPAddr{IP: net.ParseIP("::1"), Port: 443})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(header) != "PROXY TCP6 ::ffff:192.168.0.1 ::1 56324 443\r\n" {
+		t.Fatalf("unexpected v1 header %q", header)
+	}
+}
@@ -0,0 +1,58 @@
+//go:build linux
+
+package tcp
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcpiOptSynData tcpi_options 中表示 SYN 携带的数据被对端确认的标志，x/sys 没有定义
+const tcpiOptSynData = 0x20
+
+// fastOpenUsed 通过 TCP_INFO 判断 SYN 携带的数据是否被对端接受，即 TCP Fast Open 是否生效
+func fastOpenUsed(conn net.Conn) bool {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return false
+	}
+	raw, err := tcpConn.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var info *unix.TCPInfo
+	if err := raw.Control(func(fd uintptr) {
+		info, err = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	}); err != nil || info == nil {
+		return false
+	}
+	return info.Options&tcpiOptSynData != 0
+}
+
+// kernelRTT 通过 TCP_INFO 读取内核测得的往返时间，刚建立的连接只有 SYN-ACK 一个采样，平滑后的 tcpi_rtt 就是这个采样，
+// 比在 Dial 前后计时更准确（不包含调度和系统调用的耗时），需要在连接上收发其他数据之前读取。
+// SO_TIMESTAMPING 只为收发的数据打时间戳，不包括 SYN 和 SYN-ACK，不能用来测量握手
+func kernelRTT(conn net.Conn) (time.Duration, error) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return 0, fmt.Errorf("不是TCP连接")
+	}
+	raw, err := tcpConn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var info *unix.TCPInfo
+	var sysErr error
+	if err := raw.Control(func(fd uintptr) {
+		info, sysErr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	}); err != nil {
+		return 0, err
+	}
+	if sysErr != nil {
+		return 0, sysErr
+	}
+	return time.Duration(info.Rtt) * time.Microsecond, nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package tcp
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// fastOpenUsed 当前平台不支持 TCP Fast Open
+func fastOpenUsed(conn net.Conn) bool {
+	return false
+}
+
+// kernelRTT 当前平台不支持读取内核测得的往返时间
+func kernelRTT(conn net.Conn) (time.Duration, error) {
+	return 0, fmt.Errorf("当前平台不支持读取内核RTT")
+}
@@ -1,45 +1,97 @@
 package tcp
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"net"
+	"net/http"
 	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloverstd/tcping/ping"
 )
 
 var _ ping.Ping = (*Ping)(nil)
+var _ ping.Budgeter = (*Ping)(nil)
+var _ ping.Summarizer = (*Ping)(nil)
 
 func New(host string, port int, op *ping.Option, tls bool) *Ping {
+	dialer, err := ping.NewDialer(op)
+	if dialer != nil && !op.KeepAlive {
+		// net.Dialer 默认开启 keepalive，未指定 --keepalive 时关闭
+		dialer.KeepAlive = -1
+	}
 	return &Ping{
-		tls:    tls,
-		host:   host,
-		port:   port,
-		option: op,
-		dialer: &net.Dialer{
-			Resolver: op.Resolver,
-		},
+		tls:       tls,
+		host:      host,
+		port:      port,
+		option:    op,
+		proxy:     tunnelProxy(net.JoinHostPort(host, strconv.Itoa(port)), op),
+		dialer:    dialer,
+		dialerErr: err,
 	}
 }
 
+// tunnelProxy 返回连接目标时使用的 HTTP 代理，未指定代理、代理不是 http 协议或目标在 NoProxy 中时返回 nil
+func tunnelProxy(addr string, op *ping.Option) *url.URL {
+	if op.Proxy == nil || op.Proxy.Scheme != "http" {
+		return nil
+	}
+	if ping.BypassProxy(op.NoProxy, addr) {
+		return nil
+	}
+	return op.Proxy
+}
+
 type Ping struct {
 	option *ping.Option
 	host   string
 	port   int
 	dialer *net.Dialer
 	tls    bool
+	proxy  *url.URL
+
+	// 创建 Dialer 失败（例如网卡不存在）时每次探测都返回该错误
+	dialerErr error
+
+	// 保持连接模式下复用的连接，探测期间由探测独占（取出后放回），超时被放弃的探测不会与下一次探测共用连接，
+	// mu 保护 conn、connected 和 closed，Close 之后放回的连接直接关闭
+	mu         sync.Mutex
+	conn       net.Conn
+	connected  bool
+	closed     bool
+	reconnects int64
 }
 
 func (p *Ping) Ping(ctx context.Context) *ping.Stats {
-	timeout := ping.DefaultTimeout
-	if p.option.Timeout > 0 {
-		timeout = p.option.Timeout
+	if p.dialerErr != nil {
+		return &ping.Stats{Error: p.dialerErr}
 	}
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	if conn := p.takeConn(); conn != nil {
+		stats := ping.Stats{Meta: map[string]fmt.Stringer{}}
+		stats.Address = conn.RemoteAddr().String()
+		p.keepAliveMeta(conn, &stats)
+		if p.exchange(ctx, conn, &stats) {
+			p.putConn(conn)
+		}
+		return &stats
+	}
+
+	// 连接（包括 TLS 握手）使用连接超时，之后的数据交换使用读取超时，不受连接超时的限制
+	probeCtx := ctx
+	ctx, cancel := context.WithTimeout(ctx, p.timeout(p.option.ConnectTimeout))
 	defer cancel()
 
 	var stats ping.Stats
@@ -54,6 +106,25 @@ func (p *Ping) Ping(ctx context.Context) *ping.Stats {
 		},
 	})
 
+	target := "tcp://" + net.JoinHostPort(p.host, strconv.Itoa(p.port))
+	ctx = ping.WithDebugTrace(ctx, p.option, target)
+	ctx, dnsServer := ping.WithDNSServer(ctx)
+
+	stats.Meta = map[string]fmt.Stringer{}
+	if p.option.Interface != "" {
+		stats.Meta["interface"] = String(p.option.Interface)
+	}
+	if p.option.DSCP != 0 {
+		stats.Meta["dscp"] = Int(p.option.DSCP)
+	}
+	if p.option.DNSSEC && net.ParseIP(p.host) == nil {
+		if result, err := p.option.CheckDNSSEC(ctx, p.host); err != nil {
+			stats.Meta["dnssec_error"] = String(ping.FormatError(err))
+		} else {
+			stats.Meta["dnssec_ad"] = Bool(result.AD)
+			stats.Meta["dnssec_signed"] = Bool(result.Signed)
+		}
+	}
 	start := time.Now()
 	var (
 		conn    net.Conn
@@ -61,20 +132,39 @@ func (p *Ping) Ping(ctx context.Context) *ping.Stats {
 		tlsConn *tls.Conn
 		tlsErr  error
 	)
-	if p.tls {
-		tlsConn, err = tls.DialWithDialer(p.dialer, "tcp", fmt.Sprintf("%s:%d", p.host, p.port), &tls.Config{
-			InsecureSkipVerify: true,
-		})
-		if err == nil {
-			conn = tlsConn.NetConn()
-		} else {
-			tlsErr = err
-			conn, err = p.dialer.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", p.host, p.port))
+	tlsConfig := p.tlsConfig()
+	conn, err = p.connect(ctx, &stats)
+	// 握手的往返时间在建立连接后立即读取，TLS 握手的数据会带来新的采样
+	var handshakeRTT time.Duration
+	if err == nil && p.option.KernelRTT {
+		handshakeRTT, _ = kernelRTT(conn)
+	}
+	if err == nil && p.tls {
+		tlsConn = tls.Client(conn, tlsConfig)
+		p.option.Debugf(2, "%s tls start", target)
+		tlsStart := time.Now()
+		tlsErr = tlsConn.HandshakeContext(ctx)
+		p.option.Debugf(1, "%s tls done in %s version=%s err=%v", target, time.Since(tlsStart), ping.TLSVersionName(tlsConn.ConnectionState().Version), tlsErr)
+		if tlsErr != nil {
+			tlsConn = nil
+			_ = conn.Close()
+			if tlsStrict(tlsConfig) {
+				// 限制了 TLS 参数时握手失败即探测失败
+				stats.Address = conn.RemoteAddr().String()
+				err = tlsErr
+			} else {
+				// 握手失败后重新建立普通连接
+				conn, err = p.connect(ctx, &stats)
+				if err == nil && p.option.KernelRTT {
+					handshakeRTT, _ = kernelRTT(conn)
+				}
+			}
 		}
-	} else {
-		conn, err = p.dialer.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", p.host, p.port))
 	}
 	stats.Duration = time.Since(start)
+	if server := dnsServer(); server != "" {
+		stats.Meta["dns_server"] = String(server)
+	}
 	if err != nil {
 		stats.Error = err
 		if oe, ok := err.(*net.OpError); ok && oe.Addr != nil {
@@ -83,18 +173,443 @@ func (p *Ping) Ping(ctx context.Context) *ping.Stats {
 	} else {
 		stats.Connected = true
 		stats.Address = conn.RemoteAddr().String()
+		if p.option.Tunnel != nil {
+			// 隧道连接的对端是隧道本身，记录目标地址
+			stats.Address = net.JoinHostPort(p.host, strconv.Itoa(p.port))
+		}
+		if p.option.KernelRTT {
+			stats.Meta["rtt_source"] = String("wallclock")
+			if handshakeRTT > 0 {
+				stats.Meta["kernel_rtt"] = handshakeRTT
+				if tlsConn == nil {
+					// 有 TLS 握手时时间包含握手耗时，保留计时的结果
+					stats.Duration = handshakeRTT
+					stats.Meta["rtt_source"] = String("kernel")
+				}
+			}
+		}
+		p.keepAliveMeta(conn, &stats)
 		if tlsConn != nil && len(tlsConn.ConnectionState().PeerCertificates) > 0 {
 			state := tlsConn.ConnectionState()
-			stats.Extra = Meta{
-				dnsNames:   state.PeerCertificates[0].DNSNames,
-				serverName: state.ServerName,
-				version:    int(state.Version - tls.VersionTLS10),
-				notBefore:  state.PeerCertificates[0].NotBefore,
-				notAfter:   state.PeerCertificates[0].NotAfter,
+			if config := p.option.TLSConfig; config != nil && config.RootCAs != nil {
+				stats.Meta["custom_roots"] = Bool(true)
+				stats.Meta["verified"] = Bool(verifyChain(state.PeerCertificates, tlsConfig.ServerName, config.RootCAs) == nil)
 			}
+			if tlsStrict(tlsConfig) {
+				stats.Meta["tls_version"] = String(ping.TLSVersionName(state.Version))
+			}
+			if len(tlsConfig.CipherSuites) > 0 {
+				stats.Meta["tls_cipher"] = String(tls.CipherSuiteName(state.CipherSuite))
+			}
+			if len(tlsConfig.NextProtos) > 0 {
+				proto := state.NegotiatedProtocol
+				if proto == "" {
+					proto = "none"
+				}
+				stats.Meta["alpn"] = String(proto)
+			}
+			meta := Meta{
+				dnsNames:    state.PeerCertificates[0].DNSNames,
+				serverName:  state.ServerName,
+				version:     int(state.Version - tls.VersionTLS10),
+				notBefore:   state.PeerCertificates[0].NotBefore,
+				notAfter:    state.PeerCertificates[0].NotAfter,
+				ocspStapled: len(state.OCSPResponse) > 0,
+
+				chainLength: len(state.PeerCertificates),
+				issuer:      state.PeerCertificates[0].Issuer.CommonName,
+			}
+			if meta.ocspStapled {
+				var issuer *x509.Certificate
+				if len(state.PeerCertificates) > 1 {
+					issuer = state.PeerCertificates[1]
+				}
+				meta.ocspStatus = ocspStatus(state.OCSPResponse, state.PeerCertificates[0], issuer, time.Now())
+			}
+			var roots *x509.CertPool
+			if p.option.TLSConfig != nil {
+				roots = p.option.TLSConfig.RootCAs
+			}
+			meta.chainTrusted = chainTrusted(state.PeerCertificates, roots)
+			stats.Meta["chain_length"] = Int(meta.chainLength)
+			stats.Meta["issuer"] = String(meta.issuer)
+			stats.Meta["chain_trusted"] = Bool(meta.chainTrusted)
+			if p.option.CertWarnDays > 0 {
+				days, expiring := p.option.CertExpiring(meta.notAfter, time.Now())
+				stats.Meta["cert_days_left"] = Int(days)
+				if expiring {
+					stats.Meta["cert_expiring"] = Bool(true)
+					stats.Warning = fmt.Sprintf("证书 %d 天后过期", days)
+				}
+			}
+			stats.Extra = meta
 		} else if p.tls {
 			stats.Extra = bytes.NewBufferString("警告：此端口不是SSL/TLS协议，" + ping.FormatError(tlsErr) + "！")
 		}
+		if p.option.KeepOpen {
+			kept := conn
+			if tlsConn != nil {
+				kept = tlsConn
+			}
+			stats.Meta["connect"] = stats.Duration
+			if p.reconnected() {
+				stats.Meta["reconnect"] = Int(atomic.AddInt64(&p.reconnects, 1))
+			}
+			if p.exchange(probeCtx, kept, &stats) {
+				if p.option.FastOpen {
+					stats.Meta["tfo"] = Bool(fastOpenUsed(conn))
+				}
+				p.putConn(kept)
+			}
+		} else {
+			var closer io.Closer = conn
+			if tlsConn != nil {
+				closer = tlsConn
+			}
+			if len(p.option.Payload) > 0 {
+				// 每次探测在新的连接上发送数据，往返时间为回显的耗时
+				stats.Meta["connect"] = stats.Duration
+				if !p.exchange(probeCtx, closer.(net.Conn), &stats) {
+					// 交换失败时连接已经关闭
+					return &stats
+				}
+			}
+			if p.option.FastOpen {
+				// TLS 握手的 ClientHello 或发送的数据随 SYN 发送
+				stats.Meta["tfo"] = Bool(fastOpenUsed(conn))
+			}
+			p.closeConn(conn, closer)
+		}
 	}
 	return &stats
 }
+
+// chainTrusted 判断服务器发送的证书链能否到达 roots（为空时使用系统的根证书）中的根证书，
+// 用于发现服务器没有发送中间证书的问题，证书过期、域名不匹配等其他验证错误不影响结果
+func chainTrusted(certs []*x509.Certificate, roots *x509.CertPool) bool {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	// 以叶子证书生效的时间验证，避免证书过期时提前返回
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   certs[0].NotBefore,
+	})
+	var unknownAuthority x509.UnknownAuthorityError
+	return !errors.As(err, &unknownAuthority)
+}
+
+// tlsConfig 返回 --tls 探测使用的 TLS 配置，握手时不验证证书，以便证书有问题时仍然能输出证书信息
+func (p *Ping) tlsConfig() *tls.Config {
+	config := &tls.Config{}
+	if p.option.TLSConfig != nil {
+		config = p.option.TLSConfig.Clone()
+	}
+	config.InsecureSkipVerify = true
+	if config.ServerName == "" {
+		config.ServerName = p.host
+	}
+	return config
+}
+
+// tlsStrict 判断是否限制了 TLS 版本或密码套件，限制时握手失败不再回退到普通连接
+func tlsStrict(config *tls.Config) bool {
+	return config.MinVersion != 0 || config.MaxVersion != 0 || len(config.CipherSuites) > 0
+}
+
+// verifyChain 使用 roots 验证服务器发送的证书链和域名
+func verifyChain(certs []*x509.Certificate, serverName string, roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       serverName,
+	})
+	return err
+}
+
+// closeConn 按 CloseMode 关闭连接，rst 模式设置 SO_LINGER 为 0 直接发送 RST，closer 为 TLS 连接时正常关闭会先发送 close_notify
+func (p *Ping) closeConn(conn net.Conn, closer io.Closer) {
+	if p.option.CloseMode == ping.CloseRST {
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			_ = tcpConn.SetLinger(0)
+			_ = tcpConn.Close()
+			return
+		}
+	}
+	_ = closer.Close()
+}
+
+// connect 建立到目标的连接，指定了 PROXY protocol 时随后发送 PROXY protocol 头（在 TLS 握手之前）
+func (p *Ping) connect(ctx context.Context, stats *ping.Stats) (net.Conn, error) {
+	conn, err := p.dial(ctx, stats)
+	if err != nil || p.option.ProxyProtocol == "" {
+		return conn, err
+	}
+	if err := p.writeProxyHeader(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	stats.Meta["proxy_protocol"] = String(p.option.ProxyProtocol)
+	return conn, nil
+}
+
+// dial 建立到目标的连接，指定了代理时通过代理的 CONNECT 方法建立隧道
+func (p *Ping) dial(ctx context.Context, stats *ping.Stats) (net.Conn, error) {
+	host := p.host
+	if p.option.IP != "" {
+		host = p.option.IP
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(p.port))
+	if p.option.Tunnel != nil {
+		return p.option.Tunnel(ctx, p.option.DialNetwork(), addr)
+	}
+	if p.proxy == nil {
+		conn, attempts, err := ping.DialContext(ctx, p.dialer, p.option, addr)
+		if attempts > 0 {
+			stats.Meta["dns_attempts"] = Int(attempts)
+		}
+		return conn, err
+	}
+	stats.Meta["proxy"] = String(p.proxy.Redacted())
+	proxyAddr := p.proxy.Host
+	if p.proxy.Port() == "" {
+		proxyAddr = net.JoinHostPort(p.proxy.Hostname(), "80")
+	}
+	start := time.Now()
+	conn, _, err := ping.DialContext(ctx, p.dialer, p.option, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	stats.Meta["proxy_connect"] = time.Since(start)
+
+	start = time.Now()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user := p.proxy.User; user != nil {
+		password, _ := user.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	br := bufio.NewReader(conn)
+	if err = req.Write(conn); err == nil {
+		var resp *http.Response
+		if resp, err = http.ReadResponse(br, req); err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("代理建立隧道失败：%s", resp.Status)
+			}
+		}
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	stats.Meta["target_connect"] = time.Since(start)
+	if br.Buffered() > 0 {
+		// 目标先发送的数据（例如 SSH、SMTP 的 banner）可能和代理的响应一起读入了缓冲区
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn 先读取缓冲区中剩余的数据再读取连接
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// keepAliveMeta 指定 --keepalive 时开启连接的 TCP keepalive 并记录结果，复用的连接重复设置，结果反映连接当前的状态
+func (p *Ping) keepAliveMeta(conn net.Conn, stats *ping.Stats) {
+	if !p.option.KeepAlive {
+		return
+	}
+	stats.Meta["keepalive"] = Bool(p.setKeepAlive(conn) == nil)
+	if p.option.KeepAliveInterval > 0 {
+		stats.Meta["keepalive_interval"] = p.option.KeepAliveInterval
+	}
+}
+
+// setKeepAlive 开启连接的 TCP keepalive，conn 可以是保持的 TLS 连接
+func (p *Ping) setKeepAlive(conn net.Conn) error {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if buffered, ok := conn.(*bufferedConn); ok {
+		conn = buffered.Conn
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return fmt.Errorf("不是TCP连接")
+	}
+	if err := tcpConn.SetKeepAlive(true); err != nil {
+		return err
+	}
+	if p.option.KeepAliveInterval > 0 {
+		return tcpConn.SetKeepAlivePeriod(p.option.KeepAliveInterval)
+	}
+	return nil
+}
+
+// timeout 返回指定的超时，未指定时回退到 Option.Timeout
+func (p *Ping) timeout(d time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	if p.option.Timeout > 0 {
+		return p.option.Timeout
+	}
+	return ping.DefaultTimeout
+}
+
+// Budget 一次探测最长的耗时：建立连接的超时，发送数据时加上数据交换的读取超时
+func (p *Ping) Budget() time.Duration {
+	budget := p.timeout(p.option.ConnectTimeout)
+	if len(p.option.Payload) > 0 {
+		budget += p.timeout(p.option.ReadTimeout)
+	}
+	return budget
+}
+
+// takeConn 取出保持的连接，没有可以复用的连接时返回 nil
+func (p *Ping) takeConn() net.Conn {
+	if !p.option.KeepOpen {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn := p.conn
+	p.conn = nil
+	return conn
+}
+
+// putConn 放回探测完成后仍然可用的连接，已经关闭或者其他探测已经放回了连接时关闭 conn
+func (p *Ping) putConn(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.conn != nil {
+		_ = conn.Close()
+		return
+	}
+	p.conn = conn
+}
+
+// reconnected 记录建立了保持的连接，返回之前是否已经建立过（即本次为重连）
+func (p *Ping) reconnected() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	connected := p.connected
+	p.connected = true
+	return connected
+}
+
+// exchange 在 conn 上发送数据并等待回显，测量应用层往返时间，返回连接是否可以继续使用，不能使用时关闭连接以便下次重连，
+// 读写的截止时间不晚于 ctx 的截止时间，ctx 取消时立即中断
+func (p *Ping) exchange(ctx context.Context, conn net.Conn, stats *ping.Stats) bool {
+	deadline := time.Now().Add(p.timeout(p.option.ReadTimeout))
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	// 返回前等待协程退出，避免连接放回后（已被下一次探测取出）才被设置截止时间
+	stop, exited := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(stop)
+		<-exited
+	}()
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	buf := make([]byte, len(p.option.Payload))
+	start := time.Now()
+	sent, err := conn.Write(p.option.Payload)
+	var received int
+	if err == nil {
+		received, err = io.ReadFull(conn, buf)
+	}
+	stats.Duration = time.Since(start)
+	stats.Meta["bytes_sent"] = Int(sent)
+	stats.Meta["bytes_received"] = Int(received)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		stats.Connected = false
+		stats.Error = err
+		_ = conn.Close()
+		return false
+	}
+	if p.option.VerifyChecksum {
+		// 长度一致，连接仍然可以继续使用
+		ok := crc32.ChecksumIEEE(buf) == crc32.ChecksumIEEE(p.option.Payload)
+		stats.Meta["checksum_ok"] = Bool(ok)
+		if !ok {
+			stats.Connected = false
+			stats.Error = errors.New("回显数据的校验和不一致")
+			return true
+		}
+	}
+	stats.Connected = true
+	return true
+}
+
+// Summary 保持连接模式下报告重连次数
+func (p *Ping) Summary() string {
+	if !p.option.KeepOpen {
+		return ""
+	}
+	return fmt.Sprintf("Keep-open connection:\n\t%d reconnects.", atomic.LoadInt64(&p.reconnects))
+}
+
+// Close 关闭保持的连接，仍在进行中的探测完成后关闭它使用的连接
+func (p *Ping) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+type Bool bool
+
+func (b Bool) String() string {
+	return strconv.FormatBool(bool(b))
+}
+
+type String string
+
+func (s String) String() string {
+	return string(s)
+}
+
+type Int int
+
+func (i Int) String() string {
+	return strconv.Itoa(int(i))
+}
@@ -1,10 +1,24 @@
 package tcp_test
 
 import (
+	"bufio"
 	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
 	tcping "github.com/cloverstd/tcping/ping"
 	"github.com/cloverstd/tcping/ping/tcp"
-	"testing"
+	"golang.org/x/crypto/ocsp"
 )
 
 func TestPing(t *testing.T) {
@@ -23,3 +37,525 @@ func TestPing_Failed(t *testing.T) {
 		t.Fatalf("it should be connected refused error")
 	}
 }
+
+func TestPing_KeepOpen(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				// 回显一次后断开，迫使执行器重连
+				buf := make([]byte, 4)
+				if _, err := io.ReadFull(conn, buf); err == nil {
+					_, _ = conn.Write(buf)
+				}
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	ping := tcp.New("127.0.0.1", addr.Port, &tcping.Option{KeepOpen: true, Payload: []byte("ping")}, false)
+	defer ping.Close()
+	stats := ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatalf("ping failed, %s", stats.Error)
+	}
+	if sent, received := stats.Meta["bytes_sent"], stats.Meta["bytes_received"]; sent.String() != "4" || received.String() != "4" {
+		t.Fatalf("unexpected bytes sent=%s received=%s", sent, received)
+	}
+	if stats := ping.Ping(context.Background()); stats.Connected {
+		t.Fatalf("it should be dropped by the server")
+	}
+	if stats := ping.Ping(context.Background()); !stats.Connected {
+		t.Fatalf("it should reconnect, %s", stats.Error)
+	}
+	if summary := ping.Summary(); !strings.Contains(summary, "1 reconnects") {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+}
+
+func TestPing_Budget(t *testing.T) {
+	op := &tcping.Option{Timeout: 3 * time.Second, ConnectTimeout: 10 * time.Second}
+	if budget := tcp.New("127.0.0.1", 80, op, false).Budget(); budget != 10*time.Second {
+		t.Fatalf("unexpected budget %s", budget)
+	}
+	op = &tcping.Option{Timeout: 3 * time.Second, ConnectTimeout: 10 * time.Second, Payload: []byte("ping")}
+	if budget := tcp.New("127.0.0.1", 80, op, false).Budget(); budget != 13*time.Second {
+		t.Fatalf("unexpected payload budget %s", budget)
+	}
+}
+
+func TestPing_Payload(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan struct{}, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- struct{}{}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	// 不保持连接时每次探测在新的连接上发送数据
+	ping := tcp.New("127.0.0.1", addr.Port, &tcping.Option{Payload: []byte("ping")}, false)
+	for i := 0; i < 2; i++ {
+		stats := ping.Ping(context.Background())
+		if !stats.Connected {
+			t.Fatalf("ping failed, %s", stats.Error)
+		}
+		if sent, received := stats.Meta["bytes_sent"], stats.Meta["bytes_received"]; sent.String() != "4" || received.String() != "4" {
+			t.Fatalf("unexpected bytes sent=%s received=%s", sent, received)
+		}
+		if _, ok := stats.Meta["connect"]; !ok {
+			t.Fatal("it should record the connect time")
+		}
+	}
+	if len(accepted) != 2 {
+		t.Fatalf("unexpected connections %d", len(accepted))
+	}
+}
+
+func TestPing_KeepOpenKeepAlive(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	op := &tcping.Option{KeepOpen: true, Payload: []byte("ping"), KeepAlive: true, KeepAliveInterval: time.Second}
+	ping := tcp.New("127.0.0.1", addr.Port, op, false)
+	defer ping.Close()
+	for i := 0; i < 2; i++ {
+		// 复用连接的探测也记录 keepalive
+		stats := ping.Ping(context.Background())
+		if !stats.Connected {
+			t.Fatalf("ping failed, %s", stats.Error)
+		}
+		if got := stats.Meta["keepalive"]; got == nil || got.String() != "true" {
+			t.Fatalf("probe %d: unexpected keepalive %v", i, got)
+		}
+		if got := stats.Meta["keepalive_interval"]; got == nil || got.String() != "1s" {
+			t.Fatalf("probe %d: unexpected keepalive_interval %v", i, got)
+		}
+	}
+}
+
+func TestPing_KeepOpenCancel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	ping := tcp.New("127.0.0.1", addr.Port, &tcping.Option{KeepOpen: true, Payload: []byte("ping")}, false)
+	defer ping.Close()
+	for i := 0; i < 200; i++ {
+		// 与 Pinger 一样在探测返回后立即取消 ctx，不能影响放回的连接
+		ctx, cancel := context.WithCancel(context.Background())
+		stats := ping.Ping(ctx)
+		cancel()
+		if !stats.Connected {
+			t.Fatalf("probe %d failed, %s", i, stats.Error)
+		}
+	}
+	if summary := ping.Summary(); !strings.Contains(summary, "0 reconnects") {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+}
+
+func TestPing_KeepOpenStuck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for first := true; ; first = false {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(stuck bool) {
+				defer conn.Close()
+				buf := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(conn, buf); err != nil {
+						return
+					}
+					// 第一个连接读到数据后不再回显，模拟卡住的交换
+					if !stuck {
+						_, _ = conn.Write(buf)
+					}
+				}
+			}(first)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	ping := tcp.New("127.0.0.1", addr.Port, &tcping.Option{KeepOpen: true, Payload: []byte("ping")}, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	stuck := make(chan *tcping.Stats)
+	go func() {
+		stuck <- ping.Ping(ctx)
+	}()
+	// 卡住的探测被放弃后，下一次探测与它同时进行，建立新的连接
+	time.Sleep(50 * time.Millisecond)
+	stats := ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatalf("ping failed, %s", stats.Error)
+	}
+	if _, ok := stats.Meta["reconnect"]; !ok {
+		t.Fatal("it should reconnect while the first exchange is stuck")
+	}
+	cancel()
+	if stats := <-stuck; stats.Connected || !errors.Is(stats.Error, context.Canceled) {
+		t.Fatalf("unexpected stuck probe %v", stats.Error)
+	}
+	// 卡住的探测结束后不影响新的连接
+	stats = ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatalf("ping failed, %s", stats.Error)
+	}
+	if _, ok := stats.Meta["reconnect"]; ok {
+		t.Fatal("it should reuse the new connection")
+	}
+	if summary := ping.Summary(); !strings.Contains(summary, "1 reconnects") {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+	// 关闭与进行中的探测同时发生
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = ping.Ping(context.Background())
+	}()
+	_ = ping.Close()
+	<-done
+}
+
+func TestPing_Proxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	connects := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		connects <- req.Method + " " + req.Host + " " + req.Header.Get("Proxy-Authorization")
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	}()
+
+	proxy, _ := url.Parse("http://user:pass@" + ln.Addr().String())
+	ping := tcp.New("example.com", 443, &tcping.Option{Proxy: proxy}, false)
+	stats := ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatalf("ping failed, %s", stats.Error)
+	}
+	if got := <-connects; got != "CONNECT example.com:443 Basic dXNlcjpwYXNz" {
+		t.Fatalf("unexpected request %q", got)
+	}
+	for _, key := range []string{"proxy_connect", "target_connect"} {
+		if _, ok := stats.Meta[key]; !ok {
+			t.Fatalf("missing meta %s", key)
+		}
+	}
+}
+
+func TestPing_ProxyBanner(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+			return
+		}
+		// 目标先发送的数据与代理的响应在同一个数据段中到达
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\nping")
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	proxy, _ := url.Parse("http://" + ln.Addr().String())
+	op := &tcping.Option{Proxy: proxy, KeepOpen: true, Payload: []byte("ping"), ReadTimeout: time.Second}
+	ping := tcp.New("example.com", 22, op, false)
+	defer ping.Close()
+	if stats := ping.Ping(context.Background()); !stats.Connected {
+		t.Fatalf("the data after the CONNECT response should not be lost, %s", stats.Error)
+	}
+}
+
+func TestPing_RetryDNS(t *testing.T) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("unreachable")}
+		},
+	}
+	ping := tcp.New("example.com", 80, &tcping.Option{Resolver: resolver, DNSRetries: 2}, false)
+	stats := ping.Ping(context.Background())
+	if stats.Connected {
+		t.Fatalf("it should be a dns error")
+	}
+	if got := stats.Meta["dns_attempts"]; got == nil || got.String() != "3" {
+		t.Fatalf("unexpected dns_attempts %v", got)
+	}
+}
+
+func TestPing_CustomRoots(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(server.Certificate())
+	for roots, verified := range map[*x509.CertPool]string{trusted: "true", x509.NewCertPool(): "false"} {
+		ping := tcp.New("127.0.0.1", addr.Port, &tcping.Option{TLSConfig: &tls.Config{RootCAs: roots}}, true)
+		stats := ping.Ping(context.Background())
+		if !stats.Connected {
+			t.Fatalf("ping failed, %s", stats.Error)
+		}
+		if got := stats.Meta["verified"]; got == nil || got.String() != verified {
+			t.Fatalf("unexpected verified %v", got)
+		}
+	}
+}
+
+func TestPing_SNI(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	names := make(chan string, 1)
+	server.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			names <- hello.ServerName
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	ping := tcp.New("127.0.0.1", addr.Port, &tcping.Option{TLSConfig: &tls.Config{ServerName: "vhost.example.com"}}, true)
+	stats := ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatalf("ping failed, %s", stats.Error)
+	}
+	if got := <-names; got != "vhost.example.com" {
+		t.Fatalf("unexpected sni %q", got)
+	}
+	if extra := stats.Extra.String(); !strings.Contains(extra, "server_name=vhost.example.com") {
+		t.Fatalf("unexpected meta %s", extra)
+	}
+}
+
+func TestPing_OCSPStapled(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	cert := server.Certificate()
+	staple, err := ocsp.CreateResponse(cert, cert, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Hour),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, server.TLS.Certificates[0].PrivateKey.(crypto.Signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TLS.Certificates[0].OCSPStaple = staple
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	ping := tcp.New("127.0.0.1", addr.Port, &tcping.Option{}, true)
+	stats := ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatalf("ping failed, %s", stats.Error)
+	}
+	if extra := stats.Extra.String(); !strings.Contains(extra, "ocsp_stapled=true ocsp_status=good") {
+		t.Fatalf("unexpected meta %s", extra)
+	}
+}
+
+func TestPing_Chain(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(server.Certificate())
+	for roots, want := range map[*x509.CertPool]string{trusted: "true", x509.NewCertPool(): "false"} {
+		ping := tcp.New("127.0.0.1", addr.Port, &tcping.Option{TLSConfig: &tls.Config{RootCAs: roots}}, true)
+		stats := ping.Ping(context.Background())
+		if !stats.Connected {
+			t.Fatalf("ping failed, %s", stats.Error)
+		}
+		if got := stats.Meta["chain_trusted"]; got == nil || got.String() != want {
+			t.Fatalf("unexpected chain_trusted %v", got)
+		}
+		if got := stats.Meta["chain_length"]; got == nil || got.String() != "1" {
+			t.Fatalf("unexpected chain_length %v", got)
+		}
+	}
+}
+
+func TestPing_CertWarnDays(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	// 测试证书的有效期很长，足够大的天数才会触发警告
+	for days, warned := range map[int]bool{1: false, 1000000: true} {
+		ping := tcp.New("127.0.0.1", addr.Port, &tcping.Option{CertWarnDays: days}, true)
+		stats := ping.Ping(context.Background())
+		if !stats.Connected {
+			t.Fatalf("ping failed, %s", stats.Error)
+		}
+		if (stats.Warning != "") != warned {
+			t.Fatalf("unexpected warning %q with %d days", stats.Warning, days)
+		}
+	}
+}
+
+func TestPing_VerifyChecksum(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// 第一次原样回显，第二次修改一个字节
+		buf := make([]byte, 4)
+		for i := 0; i < 2; i++ {
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+			if i == 1 {
+				buf[0] ^= 0xff
+			}
+			_, _ = conn.Write(buf)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	ping := tcp.New("127.0.0.1", addr.Port, &tcping.Option{KeepOpen: true, Payload: []byte("ping"), VerifyChecksum: true}, false)
+	defer ping.Close()
+	stats := ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatalf("ping failed, %s", stats.Error)
+	}
+	if ok := stats.Meta["checksum_ok"]; ok == nil || ok.String() != "true" {
+		t.Fatalf("unexpected checksum_ok %v", ok)
+	}
+	stats = ping.Ping(context.Background())
+	if stats.Connected {
+		t.Fatal("it should fail on corrupted echo")
+	}
+	if ok := stats.Meta["checksum_ok"]; ok == nil || ok.String() != "false" {
+		t.Fatalf("unexpected checksum_ok %v", ok)
+	}
+}
+
+func TestPing_TLSVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{MinVersion: tls.VersionTLS13}
+	server.StartTLS()
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	ping := tcp.New("127.0.0.1", addr.Port, &tcping.Option{TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12}}, true)
+	stats := ping.Ping(context.Background())
+	if !stats.Connected {
+		t.Fatalf("ping failed, %s", stats.Error)
+	}
+	if got := stats.Meta["tls_version"]; got == nil || got.String() != "TLS1.3" {
+		t.Fatalf("unexpected tls_version %v", got)
+	}
+
+	// 服务器只支持 TLS 1.3 时限制最高版本为 1.2 的握手失败
+	ping = tcp.New("127.0.0.1", addr.Port, &tcping.Option{TLSConfig: &tls.Config{MaxVersion: tls.VersionTLS12}}, true)
+	stats = ping.Ping(context.Background())
+	if stats.Connected {
+		t.Fatal("it should fail without a common version")
+	}
+	if msg := tcping.FormatError(stats.Error); msg != "没有双方都支持的 TLS 版本" {
+		t.Fatalf("unexpected error %s", msg)
+	}
+}
+
+func TestPing_TLSCiphers(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}}
+	server.StartTLS()
+	defer server.Close()
+	addr := server.Listener.Addr().(*net.TCPAddr)
+
+	for suite, accepted := range map[uint16]bool{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256: true,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384: false,
+	} {
+		config := &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{suite}}
+		stats := tcp.New("127.0.0.1", addr.Port, &tcping.Option{TLSConfig: config}, true).Ping(context.Background())
+		if stats.Connected != accepted {
+			t.Fatalf("%s: unexpected result %t, %v", tls.CipherSuiteName(suite), stats.Connected, stats.Error)
+		}
+		if got := stats.Meta["tls_cipher"]; accepted && (got == nil || got.String() != tls.CipherSuiteName(suite)) {
+			t.Fatalf("unexpected tls_cipher %v", got)
+		}
+	}
+}
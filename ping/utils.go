@@ -2,9 +2,12 @@ package ping
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/url"
 	"os"
@@ -44,6 +47,53 @@ func ParseDuration(t string) (time.Duration, error) {
 	return time.ParseDuration(t)
 }
 
+// UntilBoundary 返回从 now 到下一个 interval 整点的时间，例如间隔为 1s 时等待到下一个整秒
+func UntilBoundary(now time.Time, interval time.Duration) time.Duration {
+	return interval - time.Duration(now.UnixNano()%int64(interval))
+}
+
+// MOS 根据平均延迟、抖动和丢包率（百分比）估算语音通话质量，返回 1~4.5 的分数。
+//
+// 使用简化的 ITU-T G.107 E-model：
+//
+//	有效延迟 = 平均延迟 + 2*抖动 + 10ms（编解码延迟）
+//	R = 93.2 - 有效延迟/40          （有效延迟 < 160ms）
+//	R = 93.2 - (有效延迟-120)/10    （有效延迟 >= 160ms）
+//	R = R - 2.5*丢包率
+//	MOS = 1 + 0.035*R + 0.000007*R*(R-60)*(100-R)
+//
+// 假设使用 G.711 编码且没有丢包隐藏，只适合作为粗略的参考。
+func MOS(latency, jitter time.Duration, loss float64) float64 {
+	effective := float64(latency+2*jitter)/float64(time.Millisecond) + 10
+	r := 93.2 - effective/40
+	if effective >= 160 {
+		r = 93.2 - (effective-120)/10
+	}
+	r -= 2.5 * loss
+	if r <= 0 {
+		return 1
+	}
+	if r > 100 {
+		r = 100
+	}
+	return 1 + 0.035*r + 0.000007*r*(r-60)*(100-r)
+}
+
+// Percentile 按最近秩法返回已排序的时间中第 p（0-100）百分位的值，没有数据时返回 0
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
 // ParseAddress will try to parse addr as url.URL.
 func ParseAddress(addr string) (*url.URL, error) {
 	if strings.Contains(addr, "://") {
@@ -53,6 +103,119 @@ func ParseAddress(addr string) (*url.URL, error) {
 	return url.Parse("tcp://" + addr)
 }
 
+// BypassProxy 判断 host（可以带端口）是否匹配 NoProxy 中的地址，格式同 NO_PROXY 环境变量：* 匹配全部，
+// IP 或 CIDR 匹配地址，example.com 匹配该域名及其子域名，.example.com 只匹配子域名，带端口时端口也需要一致。
+// 与 HTTP_PROXY 环境变量不同，本机地址不会自动排除，明确指定的代理对所有目标生效
+func BypassProxy(noProxy []string, host string) bool {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	ip := net.ParseIP(hostname)
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		entryHost = strings.Trim(entryHost, "[]")
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		if entryIP := net.ParseIP(entryHost); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		if strings.HasPrefix(entryHost, ".") {
+			if strings.HasSuffix(hostname, entryHost) {
+				return true
+			}
+			continue
+		}
+		if hostname == entryHost || strings.HasSuffix(hostname, "."+entryHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseWeight 读取地址中 #weight=N 注释的权重，没有注释时权重为 1
+func ParseWeight(u *url.URL) (float64, error) {
+	if u.Fragment == "" {
+		return 1, nil
+	}
+	values, err := url.ParseQuery(u.Fragment)
+	if err != nil || !values.Has("weight") {
+		return 0, fmt.Errorf("无效的目标注释 #%s，格式为 #weight=N", u.Fragment)
+	}
+	weight, err := strconv.ParseFloat(values.Get("weight"), 64)
+	if err != nil || weight <= 0 {
+		return 0, fmt.Errorf("无效的权重 %s，权重必须是正数", values.Get("weight"))
+	}
+	return weight, nil
+}
+
+// ClassifyError 根据错误的类型对错误进行归类，不依赖 FormatError 输出的文字，被包装的错误按其中的原始错误归类
+func ClassifyError(err error) ErrorCode {
+	if err == nil {
+		return ErrNone
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrDNS
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrTimeout
+	}
+	if errors.Is(err, errConnRefused) {
+		return ErrRefused
+	}
+	if isTLSError(err) {
+		return ErrTLS
+	}
+	return ErrOther
+}
+
+// isTLSError 判断是否为 TLS 握手或证书验证的错误
+func isTLSError(err error) bool {
+	var (
+		recordErr    tls.RecordHeaderError
+		unknownErr   x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		rootsErr     x509.SystemRootsError
+		constraint   x509.ConstraintViolationError
+		unhandledErr x509.UnhandledCriticalExtension
+		opErr        *net.OpError
+	)
+	switch {
+	case errors.As(err, &recordErr), errors.As(err, &unknownErr), errors.As(err, &hostnameErr),
+		errors.As(err, &invalidErr), errors.As(err, &rootsErr), errors.As(err, &constraint),
+		errors.As(err, &unhandledErr):
+		return true
+	case errors.As(err, &opErr):
+		// crypto/tls 以 net.OpError 返回收到（remote error）或发出（local error）的 TLS alert
+		return opErr.Op == "remote error" || opErr.Op == "local error"
+	}
+	return false
+}
+
 func FormatError(err error) string {
 	//fmt.Println("===>", err.Error())
 	switch err := err.(type) {
@@ -144,6 +307,10 @@ func FormatError(err error) string {
 		return "网站证书不匹配"
 	}
 
+	if strings.Contains(err.Error(), "protocol version not supported") || strings.Contains(err.Error(), "no supported versions satisfy") {
+		return "没有双方都支持的 TLS 版本"
+	}
+
 	if strings.Contains(err.Error(), "actively refused it") {
 		return "无法建立连接"
 	}
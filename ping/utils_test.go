@@ -1,7 +1,16 @@
 package ping
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -40,3 +49,149 @@ func TestFormatIP(t *testing.T) {
 		})
 	})
 }
+
+func TestClassifyError(t *testing.T) {
+
+	Convey("错误分类测试", t, func() {
+		Convey("for nil", func() {
+			So(ClassifyError(nil), ShouldEqual, ErrNone)
+		})
+
+		Convey("for dns", func() {
+			err := &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "nonexist.invalid"}}
+			So(ClassifyError(err), ShouldEqual, ErrDNS)
+			So(ClassifyError(&url.Error{Op: "Get", URL: "http://nonexist.invalid", Err: err}), ShouldEqual, ErrDNS)
+		})
+
+		Convey("for timeout", func() {
+			So(ClassifyError(context.DeadlineExceeded), ShouldEqual, ErrTimeout)
+			So(ClassifyError(fmt.Errorf("读取Http返回包失败， %w", os.ErrDeadlineExceeded)), ShouldEqual, ErrTimeout)
+			err := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+			So(ClassifyError(fmt.Errorf("读取Http返回包失败， %w", err)), ShouldEqual, ErrTimeout)
+		})
+
+		Convey("for refused", func() {
+			err := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errConnRefused)}
+			So(ClassifyError(err), ShouldEqual, ErrRefused)
+			So(ClassifyError(&url.Error{Op: "Get", URL: "http://127.0.0.1:1", Err: err}), ShouldEqual, ErrRefused)
+		})
+
+		Convey("for tls", func() {
+			So(ClassifyError(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), ShouldEqual, ErrTLS)
+			So(ClassifyError(fmt.Errorf("TLS 握手失败， %w", x509.UnknownAuthorityError{})), ShouldEqual, ErrTLS)
+			So(ClassifyError(&url.Error{Op: "Get", URL: "https://127.0.0.1", Err: x509.HostnameError{Host: "127.0.0.1", Certificate: &x509.Certificate{}}}), ShouldEqual, ErrTLS)
+			So(ClassifyError(&net.OpError{Op: "remote error", Err: errors.New("tls: protocol version not supported")}), ShouldEqual, ErrTLS)
+		})
+
+		Convey("for other", func() {
+			So(ClassifyError(errors.New("boom")), ShouldEqual, ErrOther)
+			// 只看错误的类型，文字相同也不归类
+			So(ClassifyError(errors.New("连接超时")), ShouldEqual, ErrOther)
+		})
+	})
+}
+
+func TestUntilBoundary(t *testing.T) {
+
+	Convey("间隔对齐测试", t, func() {
+		Convey("for middle of interval", func() {
+			now := time.Date(2022, 1, 1, 0, 0, 0, int(time.Millisecond*300), time.UTC)
+			So(UntilBoundary(now, time.Second), ShouldEqual, time.Millisecond*700)
+		})
+
+		Convey("for exact boundary", func() {
+			now := time.Date(2022, 1, 1, 0, 0, 10, 0, time.UTC)
+			So(UntilBoundary(now, time.Second*5), ShouldEqual, time.Second*5)
+		})
+	})
+}
+
+func TestPercentile(t *testing.T) {
+
+	Convey("百分位测试", t, func() {
+		sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+		Convey("for median", func() {
+			So(Percentile(sorted, 50), ShouldEqual, 5)
+		})
+
+		Convey("for tail", func() {
+			So(Percentile(sorted, 90), ShouldEqual, 9)
+			So(Percentile(sorted, 99), ShouldEqual, 10)
+		})
+
+		Convey("for no data", func() {
+			So(Percentile(nil, 50), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestMOS(t *testing.T) {
+
+	Convey("MOS估算测试", t, func() {
+		Convey("for good network", func() {
+			So(MOS(time.Millisecond*20, 0, 0), ShouldAlmostEqual, 4.39, 0.01)
+		})
+
+		Convey("for high latency", func() {
+			So(MOS(time.Millisecond*400, time.Millisecond*50, 0), ShouldBeLessThan, 3.6)
+		})
+
+		Convey("for total loss", func() {
+			So(MOS(time.Millisecond*20, 0, 100), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestParseWeight(t *testing.T) {
+	Convey("目标权重测试", t, func() {
+		Convey("without weight", func() {
+			u, _ := ParseAddress("example.com:80")
+			weight, err := ParseWeight(u)
+			So(err, ShouldBeNil)
+			So(weight, ShouldEqual, 1)
+		})
+
+		Convey("with weight", func() {
+			u, _ := ParseAddress("example.com:80#weight=2.5")
+			weight, err := ParseWeight(u)
+			So(err, ShouldBeNil)
+			So(weight, ShouldEqual, 2.5)
+			So(u.Port(), ShouldEqual, "80")
+		})
+
+		Convey("invalid weight", func() {
+			u, _ := ParseAddress("https://example.com#weight=-1")
+			_, err := ParseWeight(u)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSeed(t *testing.T) {
+	Convey("随机数种子测试", t, func() {
+		Seed(42)
+		first := []int{RandIntn(1000), RandIntn(1000)}
+		Seed(42)
+		So([]int{RandIntn(1000), RandIntn(1000)}, ShouldResemble, first)
+		So(RandIntn(0), ShouldEqual, 0)
+	})
+}
+
+func TestBypassProxy(t *testing.T) {
+	Convey("NoProxy 匹配", t, func() {
+		noProxy := []string{"example.com", ".internal", "10.0.0.0/8", "192.168.1.1", "db.local:5432"}
+		So(BypassProxy(noProxy, "example.com:443"), ShouldBeTrue)
+		So(BypassProxy(noProxy, "api.example.com:80"), ShouldBeTrue)
+		So(BypassProxy(noProxy, "notexample.com:80"), ShouldBeFalse)
+		So(BypassProxy(noProxy, "svc.internal:80"), ShouldBeTrue)
+		So(BypassProxy(noProxy, "internal:80"), ShouldBeFalse)
+		So(BypassProxy(noProxy, "10.1.2.3:22"), ShouldBeTrue)
+		So(BypassProxy(noProxy, "192.168.1.1:22"), ShouldBeTrue)
+		So(BypassProxy(noProxy, "db.local:5432"), ShouldBeTrue)
+		So(BypassProxy(noProxy, "db.local:3306"), ShouldBeFalse)
+		// 本机地址不会自动排除
+		So(BypassProxy(noProxy, "127.0.0.1:80"), ShouldBeFalse)
+		So(BypassProxy(nil, "localhost:80"), ShouldBeFalse)
+		So(BypassProxy([]string{"*"}, "localhost:80"), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var serveHost string
+
+var serveCmd = &cobra.Command{
+	Use:    "serve port",
+	Short:  "启动用于测试的 TCP 回显和 HTTP 服务",
+	Hidden: true,
+	Args:   cobra.ExactArgs(1),
+	Example: `
+  1. 在 8080 端口启动服务，同一个端口同时支持 tcp 回显和 http 请求
+	> tcping serve 8080
+	> tcping --tcp-keepopen --payload ping 127.0.0.1 8080
+	> tcping http://127.0.0.1:8080/status/204
+	> tcping --follow-redirects http://127.0.0.1:8080/redirect/3`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := strconv.ParseUint(args[0], 10, 16); err != nil {
+			return fmt.Errorf("端口无效 %s", args[0])
+		}
+		ln, err := net.Listen("tcp", net.JoinHostPort(serveHost, args[0]))
+		if err != nil {
+			return err
+		}
+		server := newTestServer(ln)
+		cmd.Printf("Serving tcp echo and http on %s\n", ln.Addr())
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		errC := make(chan error, 1)
+		go func() {
+			errC <- server.Serve()
+		}()
+		select {
+		case <-sigs:
+			return server.Close()
+		case err := <-errC:
+			return err
+		}
+	},
+}
+
+// httpMethods 用于区分 http 请求和 tcp 回显数据的请求方法
+var httpMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodConnect: true,
+	http.MethodOptions: true, http.MethodTrace: true,
+}
+
+const (
+	// sniffLen 区分 http 请求时读取的字节数，即最长的请求方法加上空格
+	sniffLen = len(http.MethodOptions) + 1
+	// sniffTimeout 等待区分请求方法所需数据的最长时间
+	sniffTimeout = 200 * time.Millisecond
+)
+
+// testServer 在同一个端口上提供 tcp 回显和 http 服务，根据连接开头的数据是否为请求方法加空格区分
+type testServer struct {
+	ln    net.Listener
+	http  *http.Server
+	conns *connListener
+}
+
+func newTestServer(ln net.Listener) *testServer {
+	return &testServer{
+		ln:    ln,
+		http:  &http.Server{Handler: testHandler()},
+		conns: &connListener{addr: ln.Addr(), conns: make(chan net.Conn), done: make(chan struct{})},
+	}
+}
+
+// Serve 接受连接直到 Close 被调用
+func (s *testServer) Serve() error {
+	go func() {
+		_ = s.http.Serve(s.conns)
+	}()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			select {
+			case <-s.conns.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) Close() error {
+	_ = s.conns.Close()
+	_ = s.http.Close()
+	return s.ln.Close()
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	// 只连接不发送数据的 tcp 探测在这里读到 EOF 后关闭
+	if _, err := reader.Peek(1); err != nil {
+		_ = conn.Close()
+		return
+	}
+	// 请求行可能分多段到达，等待足够区分请求方法的数据
+	_ = conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	isHTTP := sniffHTTP(reader)
+	_ = conn.SetReadDeadline(time.Time{})
+	if isHTTP {
+		select {
+		case s.conns.conns <- &bufferedConn{Conn: conn, reader: reader}:
+		case <-s.conns.done:
+			_ = conn.Close()
+		}
+		return
+	}
+	_, _ = io.Copy(conn, reader)
+	_ = conn.Close()
+}
+
+// sniffHTTP 逐字节读取连接开头的数据，以请求方法加空格开头时返回 true，
+// 数据不可能是请求方法的开头时立即返回，不等待 tcp 回显的后续数据
+func sniffHTTP(reader *bufio.Reader) bool {
+	for n := 1; n <= sniffLen; n++ {
+		data, err := reader.Peek(n)
+		if err != nil {
+			return false
+		}
+		if data[n-1] == ' ' {
+			return httpMethods[string(data[:n-1])]
+		}
+		prefix := false
+		for method := range httpMethods {
+			if strings.HasPrefix(method, string(data)) {
+				prefix = true
+				break
+			}
+		}
+		if !prefix {
+			return false
+		}
+	}
+	return false
+}
+
+// testHandler 返回测试用的 http 处理函数：
+// /status/N 返回状态码 N，/redirect/N 重定向 N 次后返回 200，其他路径返回 200 并回显请求体
+func testHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status/", func(w http.ResponseWriter, r *http.Request) {
+		code, err := strconv.Atoi(r.URL.Path[len("/status/"):])
+		if err != nil || code < 100 || code > 999 {
+			http.Error(w, "invalid status", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(code)
+	})
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.URL.Path[len("/redirect/"):])
+		if err != nil || n < 0 {
+			http.Error(w, "invalid redirect count", http.StatusBadRequest)
+			return
+		}
+		if n == 0 {
+			_, _ = io.WriteString(w, "ok\n")
+			return
+		}
+		http.Redirect(w, r, "/redirect/"+strconv.Itoa(n-1), http.StatusFound)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if n, _ := io.Copy(w, r.Body); n == 0 {
+			_, _ = io.WriteString(w, "ok\n")
+		}
+	})
+	return mux
+}
+
+// connListener 把 testServer 识别出的 http 连接交给 http.Server
+type connListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+// bufferedConn 先读取识别协议时已经缓存的数据
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveHost, "host", "127.0.0.1", "监听的地址。")
+	rootCmd.AddCommand(serveCmd)
+}
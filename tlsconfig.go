@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	caCert string
+	sni    string
+	alpn   []string
+	tlsMin string
+	tlsMax string
+
+	tlsCiphers []string
+)
+
+// tlsVersions --tls-min/--tls-max 支持的版本
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion 解析 1.0~1.3 形式的 TLS 版本，为空时返回 0 表示使用默认值
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	if v, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(version), "tls")]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("无效的 TLS 版本 %s，可选 1.0、1.1、1.2、1.3", version)
+}
+
+// parseCipherSuites 把密码套件名称（例如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256）转换为 ID，包括不安全的套件，
+// TLS 1.3 的套件不能配置
+func parseCipherSuites(names []string) ([]uint16, error) {
+	suites := map[string]*tls.CipherSuite{}
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites[suite.Name] = suite
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		suite, ok := suites[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("未知的密码套件 %s", name)
+		}
+		if len(suite.SupportedVersions) == 1 && suite.SupportedVersions[0] == tls.VersionTLS13 {
+			return nil, fmt.Errorf("TLS 1.3 的密码套件 %s 不能指定", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
+
+// buildTLSConfig 根据 TLS 相关的参数创建 tcp --tls 和 https 探测共用的 TLS 配置，没有指定任何参数时返回 nil 使用默认配置
+func buildTLSConfig() (*tls.Config, error) {
+	if caCert == "" && sni == "" && len(alpn) == 0 && tlsMin == "" && tlsMax == "" && len(tlsCiphers) == 0 {
+		return nil, nil
+	}
+	config := &tls.Config{ServerName: sni, NextProtos: alpn}
+	var err error
+	if config.MinVersion, err = parseTLSVersion(tlsMin); err != nil {
+		return nil, err
+	}
+	if config.MaxVersion, err = parseTLSVersion(tlsMax); err != nil {
+		return nil, err
+	}
+	if len(tlsCiphers) > 0 {
+		if config.CipherSuites, err = parseCipherSuites(tlsCiphers); err != nil {
+			return nil, err
+		}
+		if config.MaxVersion == 0 {
+			// TLS 1.3 不使用 CipherSuites，协商到 1.3 时无法测试指定的密码套件
+			config.MaxVersion = tls.VersionTLS12
+		}
+	}
+	if config.MinVersion != 0 && config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return nil, fmt.Errorf("--tls-min 不能大于 --tls-max")
+	}
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s 中没有 PEM 格式的证书", caCert)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&sni, "sni", "", `TLS 握手时发送的 SNI，默认使用目标的域名，用于通过 IP 探测共享地址后面的指定站点。`)
+	rootCmd.Flags().StringSliceVar(&alpn, "alpn", nil, `TLS 握手时通过 ALPN 提供的协议，多个用逗号分隔，例如 h2,http/1.1，协商的结果记录在 alpn 中。`)
+	rootCmd.Flags().StringVar(&tlsMin, "tls-min", "", `TLS 握手允许的最低版本（1.0、1.1、1.2、1.3），无法满足时探测失败，协商的版本记录在 tls_version 中，用于验证服务器拒绝旧版本。`)
+	rootCmd.Flags().StringVar(&tlsMax, "tls-max", "", `TLS 握手允许的最高版本（1.0、1.1、1.2、1.3），无法满足时探测失败。`)
+	rootCmd.Flags().StringSliceVar(&tlsCiphers, "tls-ciphers", nil, `TLS 握手时提供的密码套件，多个用逗号分隔，例如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256，握手失败时探测失败，协商的套件记录在 tls_cipher 中。TLS 1.3 的套件不能指定，未指定 --tls-max 时最高使用 TLS 1.2。`)
+	rootCmd.Flags().StringVar(&caCert, "cacert", "", `使用指定文件（PEM 格式）中的 CA 证书验证服务器证书，用于私有 CA 签发的证书。`)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloverstd/tcping/ping"
+)
+
+// runWait 执行 Pinger 直到目标达到期望的状态、超过 --wait-timeout 或收到停止信号，返回是否达到期望的状态
+func runWait(pinger *ping.Pinger, stopC <-chan struct{}) bool {
+	var deadline <-chan time.Time
+	if waitTimeout != "" {
+		d, err := ping.ParseDuration(waitTimeout)
+		if err != nil {
+			fmt.Println("解析等待时间失败，", err)
+			return false
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	start := time.Now()
+	go pinger.Ping()
+	select {
+	case <-stopC:
+	case <-deadline:
+	case <-pinger.Done():
+	}
+	pinger.Stop()
+	result := pinger.Statistics()
+	switch {
+	case pinger.Up():
+		fmt.Printf("\nTarget is up after %s (%d probes).\n", time.Since(start), result.Counter)
+		return true
+	case pinger.Down():
+		fmt.Printf("\nTarget is down after %s (%d probes).\n", time.Since(start), result.Counter)
+		return true
+	case pinger.StopOnUp > 0:
+		fmt.Printf("\nTarget is still down after %s (%d probes).\n", time.Since(start), result.Counter)
+	default:
+		fmt.Printf("\nTarget is still up after %s (%d probes).\n", time.Since(start), result.Counter)
+	}
+	return false
+}